@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	adminapp "github.com/burenotti/go_health_backend/internal/app/admin"
+	"github.com/burenotti/go_health_backend/internal/app/messagebus"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/config"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/leporo/sqlf"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// admin grants a role to an existing user. It is how the first administrator
+// is created; the others can be managed through the admin API.
+func main() {
+	var configPath, email, role string
+	flag.StringVar(&configPath, "config", "config/config.yaml", "path to config file")
+	flag.StringVar(&email, "email", "", "email of the user")
+	flag.StringVar(&role, "role", auth.RoleAdmin, "role to grant, admin or user")
+	flag.Parse()
+
+	if email == "" {
+		fmt.Fprintln(os.Stderr, "-email is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.MustLoad(configPath)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	sqlf.SetDialect(sqlf.PostgreSQL)
+
+	db, err := sql.Open("pgx", cfg.DB.DSN)
+	if err != nil {
+		panic("failed to connect database: " + err.Error())
+	}
+	defer db.Close()
+
+	uow := unitofwork.New[*adminapp.AtomicContext](
+		storage.DB{DB: db},
+		adminapp.NewAtomicContext,
+		messagebus.New(logger),
+		logger,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := adminapp.New(logger).Bootstrap(ctx, uow, email, role); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to set role:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s now has the %s role\n", email, role)
+}
@@ -3,22 +3,37 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"flag"
 	"github.com/burenotti/go_health_backend/internal/adapter/api"
+	"github.com/burenotti/go_health_backend/internal/adapter/clientip"
+	"github.com/burenotti/go_health_backend/internal/adapter/geoip"
+	"github.com/burenotti/go_health_backend/internal/adapter/mail"
+	"github.com/burenotti/go_health_backend/internal/adapter/oidc"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	accountapp "github.com/burenotti/go_health_backend/internal/app/account"
+	adminapp "github.com/burenotti/go_health_backend/internal/app/admin"
+	apikeyapp "github.com/burenotti/go_health_backend/internal/app/apikey"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	exportapp "github.com/burenotti/go_health_backend/internal/app/export"
 	groupservice "github.com/burenotti/go_health_backend/internal/app/group"
 	inviteservice "github.com/burenotti/go_health_backend/internal/app/invite"
 	"github.com/burenotti/go_health_backend/internal/app/messagebus"
 	metricservice "github.com/burenotti/go_health_backend/internal/app/metric"
+	"github.com/burenotti/go_health_backend/internal/app/notify"
+	onboardingapp "github.com/burenotti/go_health_backend/internal/app/onboarding"
+	"github.com/burenotti/go_health_backend/internal/app/passwordpolicy"
 	profileapp "github.com/burenotti/go_health_backend/internal/app/profile"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/config"
 	"github.com/burenotti/go_health_backend/internal/domain"
 	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/export"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/leporo/sqlf"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -48,29 +63,127 @@ func main() {
 		panic("failed to connect database: " + err.Error())
 	}
 
+	keys, err := authapp.LoadKeySet(
+		cfg.JWT.Algorithm,
+		cfg.JWT.KeyID,
+		cfg.JWT.PrivateKeyFile,
+		cfg.JWT.VerificationKeys,
+		cfg.JWT.Secret,
+		cfg.JWT.AcceptLegacyHMAC,
+	)
+	if err != nil {
+		panic("failed to load jwt keys: " + err.Error())
+	}
+
 	authorizer := &authapp.Authorizer{
-		Cost:             bcrypt.DefaultCost,
-		Secret:           cfg.JWT.Secret,
+		Argon2: authapp.Argon2Params{
+			Memory:      cfg.Auth.Argon2.Memory,
+			Iterations:  cfg.Auth.Argon2.Iterations,
+			Parallelism: cfg.Auth.Argon2.Parallelism,
+			SaltLength:  authapp.DefaultArgon2Params.SaltLength,
+			KeyLength:   authapp.DefaultArgon2Params.KeyLength,
+		},
+		Keys:             keys,
 		AccessTokenTTL:   cfg.JWT.AccessTokenTTL,
 		AuthorizationTTL: cfg.JWT.RefreshTokenTTL,
+		TOTPSecrets:      initTOTPSecrets(cfg),
+	}
+
+	revocations := authapp.NewRevocationList(
+		userstorage.NewPostgresStorage(&storage.DB{DB: db}, logger),
+		cfg.JWT.RevocationCacheSize,
+		cfg.JWT.AccessTokenTTL,
+		cfg.JWT.RevocationCacheTTL,
+	)
+	bus.Register(auth.EventLogout, revocations.HandleLogout)
+
+	if cfg.Auth.LinkSecret == cfg.JWT.Secret {
+		panic("auth.link_secret must differ from jwt.secret")
 	}
+	links := &authapp.LinkSigner{Secret: []byte(cfg.Auth.LinkSecret)}
+
+	authService := authapp.NewService(
+		authorizer,
+		links,
+		logger,
+		authapp.PasswordResetTTL(cfg.Auth.PasswordResetTTL),
+		authapp.EmailVerification(
+			cfg.Auth.EmailVerification.TTL,
+			cfg.Auth.EmailVerification.RequiredForLogin,
+		),
+		authapp.SecondFactor(cfg.Auth.MFA.Issuer, cfg.Auth.MFA.ChallengeTTL),
+		authapp.Lockout(
+			auth.LockoutPolicy(cfg.Auth.Lockout.Account),
+			auth.LockoutPolicy(cfg.Auth.Lockout.Address),
+		),
+		authapp.ExternalProviders(initProviders(cfg), cfg.Auth.OIDC.StateTTL),
+		authapp.PasswordPolicy(initPasswordPolicy(cfg)),
+		authapp.MagicLink(cfg.Auth.MagicLink.TTL),
+		authapp.MagicLinkRequests(
+			cfg.Auth.MagicLink.Requests.PerAddress,
+			cfg.Auth.MagicLink.Requests.PerEmail,
+			cfg.Auth.MagicLink.Requests.Window,
+		),
+		authapp.EmailChange(cfg.Auth.EmailChange.TTL, cfg.Auth.EmailChange.UndoTTL),
+	)
+
+	mailTokens := authapp.MailTokens{
+		Service: authService,
+		UoW:     unitofwork.New[*authapp.AtomicContext](storage.DB{DB: db}, authapp.NewAtomicContext, bus, logger),
+	}
+	notifier := notify.New(initMailer(cfg, logger), mailTokens, cfg.App.PublicURL, logger)
+	bus.Register(auth.EventCreated, notifier.OnUserCreated)
+	bus.Register(auth.EventEmailVerificationRequested, notifier.OnEmailVerificationRequested)
+	bus.Register(auth.EventPasswordResetRequested, notifier.OnPasswordResetRequested)
+	bus.Register(auth.EventMagicLinkRequested, notifier.OnMagicLinkRequested)
+	bus.Register(auth.EventEmailChangeRequested, notifier.OnEmailChangeRequested)
+	bus.Register(auth.EventNewDeviceLogin, notifier.OnNewDeviceLogin)
+
+	auditService := auditapp.New(logger)
 
-	authService := authapp.NewService(authorizer, logger)
 	profileService := profileapp.New(logger)
 	inviteService := inviteservice.New(logger)
 	groupService := groupservice.New(logger)
 	metricService := metricservice.New(logger)
+	accountService := accountapp.New(
+		authorizer,
+		cfg.Account.DeletionGracePeriod,
+		logger,
+		accountapp.AttemptRetention(max(
+			cfg.Auth.Lockout.Account.Window,
+			cfg.Auth.Lockout.Address.Window,
+			cfg.Auth.MagicLink.Requests.Window,
+		)),
+	)
+	exportService := exportapp.New(links, cfg.Export.TTL, logger)
+	apiKeyService := apikeyapp.New(logger)
+	onboardingService := onboardingapp.New(authService, logger)
+	adminService := adminapp.New(logger, adminapp.Impersonation(authorizer, cfg.Admin.ImpersonationTTL))
+	bus.Register(export.EventRequested, exportService.HandleRequested(
+		unitofwork.New[*exportapp.AtomicContext](storage.DB{DB: db}, exportapp.NewAtomicContext, bus, logger),
+	))
 
 	server := api.NewServer(
 		api.Addr(cfg.Server.Host, cfg.Server.Port),
 		api.Logger(logger),
+		api.TrustedProxies(initClientIPResolver(cfg)),
+		api.GeoDatabase(initGeoDatabase(cfg)),
+		api.Cookies(initCookieSession(cfg)),
 		api.DBContext(storage.DB{DB: db}),
 		api.MessageBus(bus),
+		api.Revocations(revocations),
+		api.VerifiedEmailRoutes(cfg.Auth.EmailVerification.RequiredRoutes),
 		api.AuthService(authService),
 		api.ProfileService(profileService),
 		api.GroupService(groupService),
 		api.InviteService(inviteService),
 		api.MetricService(metricService),
+		api.AccountService(accountService),
+		api.ExportService(exportService),
+		api.APIKeyService(apiKeyService),
+		api.AuditService(auditService),
+		api.AdminService(adminService),
+		api.OnboardingService(onboardingService),
 	)
 
 	ctx := context.Background()
@@ -78,6 +191,12 @@ func main() {
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	go accountService.RunPurge(
+		ctx,
+		unitofwork.New[*accountapp.AtomicContext](storage.DB{DB: db}, accountapp.NewAtomicContext, bus, logger),
+		cfg.Account.PurgeInterval,
+	)
+
 	errCh := make(chan error)
 
 	go func() {
@@ -121,3 +240,103 @@ func initLogger(cfg *config.Config) *slog.Logger {
 
 	return slog.New(handler)
 }
+
+func initMailer(cfg *config.Config, logger *slog.Logger) notify.Mailer {
+	switch cfg.Mail.Driver {
+	case config.MailDriverSMTP:
+		return &mail.SMTPMailer{
+			Host:     cfg.Mail.SMTP.Host,
+			Port:     cfg.Mail.SMTP.Port,
+			Username: cfg.Mail.SMTP.Username,
+			Password: cfg.Mail.SMTP.Password,
+			From:     cfg.Mail.From,
+		}
+	case config.MailDriverLog:
+		return &mail.LogMailer{
+			Path:   cfg.Mail.LogFile,
+			From:   cfg.Mail.From,
+			Logger: logger,
+		}
+	default:
+		panic("invalid mail driver")
+	}
+}
+
+func initProviders(cfg *config.Config) map[string]authapp.IdentityProvider {
+	providers := make(map[string]authapp.IdentityProvider, len(cfg.Auth.OIDC.Providers))
+	for name, p := range cfg.Auth.OIDC.Providers {
+		providers[name] = oidc.NewProvider(oidc.Config(p), nil)
+	}
+	return providers
+}
+
+func initTOTPSecrets(cfg *config.Config) *authapp.SecretBox {
+	key, err := base64.StdEncoding.DecodeString(cfg.Auth.MFA.SecretKey)
+	if err != nil {
+		panic("failed to decode auth.mfa.secret_key: " + err.Error())
+	}
+
+	box, err := authapp.NewSecretBox(key)
+	if err != nil {
+		panic("invalid auth.mfa.secret_key: " + err.Error())
+	}
+	return box
+}
+
+func initClientIPResolver(cfg *config.Config) *clientip.Resolver {
+	r, err := clientip.NewResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		panic("failed to parse trusted proxies: " + err.Error())
+	}
+	return r
+}
+
+func initGeoDatabase(cfg *config.Config) *geoip.Database {
+	if cfg.Geo.ASNDatabaseFile == "" {
+		return nil
+	}
+
+	db, err := geoip.Load(cfg.Geo.ASNDatabaseFile)
+	if err != nil {
+		panic("failed to load geoip database: " + err.Error())
+	}
+	return db
+}
+
+func initCookieSession(cfg *config.Config) *api.CookieSession {
+	session := cfg.Auth.Session
+	if session.Transport == config.TokenTransportHeader {
+		return nil
+	}
+
+	sameSite := map[config.SameSite]http.SameSite{
+		config.SameSiteStrict: http.SameSiteStrictMode,
+		config.SameSiteLax:    http.SameSiteLaxMode,
+		config.SameSiteNone:   http.SameSiteNoneMode,
+	}
+	return &api.CookieSession{
+		HeaderTokens: session.Transport == config.TokenTransportBoth,
+		Domain:       session.CookieDomain,
+		Secure:       session.CookieSecure,
+		SameSite:     sameSite[session.CookieSameSite],
+	}
+}
+
+func initPasswordPolicy(cfg *config.Config) *passwordpolicy.Policy {
+	p := cfg.Auth.PasswordPolicy
+	rules := []passwordpolicy.Rule{
+		passwordpolicy.Length{Min: p.MinLength, Max: p.MaxLength},
+		passwordpolicy.NoEmail{},
+		passwordpolicy.Strength{MinScore: p.MinScore},
+	}
+
+	if p.BreachedFilterFile != "" {
+		filter, err := passwordpolicy.LoadBloomFilter(p.BreachedFilterFile)
+		if err != nil {
+			panic("failed to load breached passwords filter: " + err.Error())
+		}
+		rules = append(rules, passwordpolicy.Breached{Filter: filter})
+	}
+
+	return passwordpolicy.New(rules...)
+}
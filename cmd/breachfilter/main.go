@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/app/passwordpolicy"
+	"os"
+	"strings"
+)
+
+// breachfilter builds the breached passwords filter from SHA-1 hashes read
+// from stdin, one per line. Lines in the "HASH:COUNT" format of breached
+// password dumps are accepted as well.
+func main() {
+	var (
+		output string
+		count  uint64
+		rate   float64
+		plain  bool
+	)
+	flag.StringVar(&output, "o", "breached.bloom", "path to the filter file")
+	flag.Uint64Var(&count, "n", 0, "number of hashes in the input")
+	flag.Float64Var(&rate, "p", 0.001, "false positive rate")
+	flag.BoolVar(&plain, "plain", false, "read plain passwords instead of hashes")
+	flag.Parse()
+
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "-n is required")
+		os.Exit(2)
+	}
+
+	filter := passwordpolicy.NewBloomFilter(count, rate)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	added := uint64(0)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if plain {
+			filter.Add(sha1.Sum([]byte(line)))
+			added++
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		var sum [sha1.Size]byte
+		if n, err := hex.Decode(sum[:], []byte(hash)); err != nil || n != sha1.Size {
+			fmt.Fprintf(os.Stderr, "skipping invalid hash %q\n", hash)
+			continue
+		}
+		filter.Add(sum)
+		added++
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if _, err := filter.WriteTo(w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("added %d hashes to %s\n", added, output)
+}
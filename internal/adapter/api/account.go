@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	accountapp "github.com/burenotti/go_health_backend/internal/app/account"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (s *Server) MountAccount() {
+	s.handler.DELETE("/auth/account", s.DeleteAccount, s.LoginRequired())
+}
+
+func (s *Server) getAccountUoW() *unitofwork.UnitOfWork[*accountapp.AtomicContext] {
+	return unitofwork.New[*accountapp.AtomicContext](
+		s.db,
+		accountapp.NewAtomicContext,
+		s.msgBus,
+		s.logger,
+	)
+}
+
+type DeleteAccountRequest struct {
+	Password         string `json:"password" validate:"required_without=ReauthToken"`
+	ReauthToken      string `json:"reauth_token"`
+	TransferGroupsTo string `json:"transfer_groups_to" validate:"omitempty,uuid"`
+}
+
+func (s *Server) DeleteAccount(c echo.Context) error {
+	var req DeleteAccountRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	reauth, err := s.authService.Reauthentication(user.UserID, req.Password, req.ReauthToken)
+	if err != nil {
+		return JsonError(c, http.StatusUnauthorized, err)
+	}
+
+	uow := s.getAccountUoW()
+	err = s.accountService.DeleteAccount(
+		c.Request().Context(),
+		uow,
+		user.UserID,
+		reauth,
+		req.TransferGroupsTo,
+	)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return JsonError(c, http.StatusBadRequest, "password is invalid")
+		}
+		if errors.Is(err, auth.ErrReauthenticationRequired) {
+			return JsonError(c, http.StatusUnauthorized, auth.ErrReauthenticationRequired)
+		}
+		if errors.Is(err, accountapp.ErrInvalidTransferTarget) {
+			return JsonError(c, http.StatusBadRequest, err)
+		}
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return JsonError(c, http.StatusNotFound, err)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
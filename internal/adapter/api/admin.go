@@ -0,0 +1,298 @@
+package api
+
+import (
+	"errors"
+	adminapp "github.com/burenotti/go_health_backend/internal/app/admin"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"net/http"
+	"time"
+)
+
+func (s *Server) MountAdmin() {
+	loginRequired := s.LoginRequired()
+	adminRoutes := s.handler.Group("/admin", loginRequired, notImpersonated)
+
+	adminRoutes.GET("/users", s.AdminSearchUsers)
+	adminRoutes.GET("/users/:user_id/sessions", s.AdminListSessions)
+	adminRoutes.DELETE("/users/:user_id/sessions", s.AdminForceLogout)
+	adminRoutes.POST("/users/:user_id/lock", s.AdminLockUser)
+	adminRoutes.POST("/users/:user_id/unlock", s.AdminUnlockUser)
+	adminRoutes.PUT("/users/:user_id/role", s.AdminSetRole)
+	adminRoutes.GET("/users/:user_id/audit", s.AdminListAuditLog)
+	adminRoutes.POST("/users/:user_id/impersonate", s.AdminImpersonate)
+	adminRoutes.PUT("/groups/:group_id/owner", s.AdminReassignGroup)
+}
+
+func (s *Server) getAdminUoW() *unitofwork.UnitOfWork[*adminapp.AtomicContext] {
+	return unitofwork.New[*adminapp.AtomicContext](
+		s.db,
+		adminapp.NewAtomicContext,
+		s.msgBus,
+		s.logger,
+	)
+}
+
+// notImpersonated keeps impersonation tokens away from the admin routes even
+// if the impersonated user is promoted while the token is valid.
+func notImpersonated(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Get(KeyCurrentUser).(*authapp.AccessTokenData).IsImpersonated() {
+			return JsonError(c, http.StatusForbidden, adminapp.ErrAdminRequired)
+		}
+		return next(c)
+	}
+}
+
+func adminError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, adminapp.ErrAdminRequired):
+		return JsonError(c, http.StatusForbidden, err)
+	case errors.Is(err, auth.ErrUserNotFound), errors.Is(err, group.ErrGroupNotFound):
+		return JsonError(c, http.StatusNotFound, err)
+	case errors.Is(err, adminapp.ErrOwnAccount),
+		errors.Is(err, adminapp.ErrInvalidGroupOwner),
+		errors.Is(err, adminapp.ErrImpersonateAdmin),
+		errors.Is(err, auth.ErrInvalidRole):
+		return JsonError(c, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, adminapp.ErrSessionInactive):
+		return JsonError(c, http.StatusUnauthorized, err)
+	case errors.Is(err, group.ErrGroupArchived):
+		return JsonError(c, http.StatusConflict, err)
+	}
+	return JsonError(c, http.StatusInternalServerError, err)
+}
+
+func currentAdminID(c echo.Context) string {
+	return c.Get(KeyCurrentUser).(*authapp.AccessTokenData).UserID
+}
+
+type AdminUser struct {
+	UserID    string     `json:"user_id"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Verified  bool       `json:"verified"`
+	CreatedAt time.Time  `json:"created_at"`
+	LockedAt  *time.Time `json:"locked_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type AdminSearchUsersRequest struct {
+	Email  string `query:"email" validate:"required"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=200"`
+	Offset int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+type AdminSearchUsersResponse struct {
+	Users []AdminUser `json:"users"`
+}
+
+func (s *Server) AdminSearchUsers(c echo.Context) error {
+	var req AdminSearchUsersRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	users, err := s.adminService.SearchUsers(
+		c.Request().Context(),
+		s.getAdminUoW(),
+		currentAdminID(c),
+		req.Email,
+		defaultAuditLimit(req.Limit),
+		req.Offset,
+	)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, AdminSearchUsersResponse{
+		Users: lo.Map(users, func(u *auth.User, _ int) AdminUser {
+			return AdminUser{
+				UserID:    u.UserID,
+				Email:     u.Email,
+				Role:      u.Role,
+				Verified:  u.IsVerified(),
+				CreatedAt: u.CreatedAt,
+				LockedAt:  u.LockedAt,
+				DeletedAt: u.DeletedAt,
+			}
+		}),
+	})
+}
+
+type AdminUserRequest struct {
+	UserID string `param:"user_id" validate:"required,uuid"`
+}
+
+func (s *Server) AdminListSessions(c echo.Context) error {
+	var req AdminUserRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	u, err := s.adminService.ListSessions(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), req.UserID)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, ListSessionsResponse{
+		Sessions: lo.Map(u.Sessions(), func(a *auth.Authorization, _ int) Session {
+			return Session{
+				SessionID:   a.FamilyID,
+				Browser:     a.Device.Browser,
+				OS:          a.Device.OS,
+				IPAddress:   a.Device.IPAddress,
+				Country:     a.Device.Country,
+				Network:     a.Device.ASOrg,
+				Model:       a.Device.Model,
+				StartedAt:   u.SessionStartedAt(a.FamilyID),
+				RefreshedAt: a.CreatedAt,
+				ValidUntil:  a.ValidUntil,
+			}
+		}),
+	})
+}
+
+func (s *Server) AdminForceLogout(c echo.Context) error {
+	var req AdminUserRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	if err := s.adminService.ForceLogout(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), req.UserID); err != nil {
+		return adminError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type AdminLockUserRequest struct {
+	UserID string `param:"user_id" validate:"required,uuid"`
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+func (s *Server) AdminLockUser(c echo.Context) error {
+	var req AdminLockUserRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	err := s.adminService.LockUser(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), req.UserID, req.Reason)
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) AdminUnlockUser(c echo.Context) error {
+	var req AdminUserRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	if err := s.adminService.UnlockUser(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), req.UserID); err != nil {
+		return adminError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type AdminSetRoleRequest struct {
+	UserID string `param:"user_id" validate:"required,uuid"`
+	Role   string `json:"role" validate:"required,oneof=user admin"`
+}
+
+func (s *Server) AdminSetRole(c echo.Context) error {
+	var req AdminSetRoleRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	err := s.adminService.SetRole(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), req.UserID, req.Role)
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type AdminListAuditLogRequest struct {
+	UserID string `param:"user_id" validate:"required,uuid"`
+	Action string `query:"action"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=200"`
+	Offset int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+func (s *Server) AdminListAuditLog(c echo.Context) error {
+	var req AdminListAuditLogRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	entries, err := s.adminService.ListAuditLog(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), audit.Filter{
+		UserID: req.UserID,
+		Action: req.Action,
+		Limit:  defaultAuditLimit(req.Limit),
+		Offset: req.Offset,
+	})
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, ListAuditLogResponse{Entries: toAuditEntries(entries)})
+}
+
+type AdminReassignGroupRequest struct {
+	GroupID string `param:"group_id" validate:"required"`
+	CoachID string `json:"coach_id" validate:"required,uuid"`
+}
+
+func (s *Server) AdminReassignGroup(c echo.Context) error {
+	var req AdminReassignGroupRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	err := s.adminService.ReassignGroup(c.Request().Context(), s.getAdminUoW(), currentAdminID(c), req.GroupID, req.CoachID)
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type AdminImpersonateRequest struct {
+	UserID string `param:"user_id" validate:"required,uuid"`
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+type AdminImpersonateResponse struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (s *Server) AdminImpersonate(c echo.Context) error {
+	var req AdminImpersonateRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	admin := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	res, err := s.adminService.Impersonate(
+		c.Request().Context(),
+		s.getAdminUoW(),
+		admin.UserID,
+		admin.Authorization,
+		req.UserID,
+		req.Reason,
+	)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, AdminImpersonateResponse{
+		AccessToken: res.AccessToken,
+		ExpiresAt:   res.ExpiresAt,
+	})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	apikeyapp "github.com/burenotti/go_health_backend/internal/app/apikey"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/apikey"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"net/http"
+	"time"
+)
+
+func (s *Server) MountAPIKeys() {
+	loginRequired := s.LoginRequired()
+	s.handler.POST("/auth/api-keys", s.CreateAPIKey, loginRequired)
+	s.handler.GET("/auth/api-keys", s.ListAPIKeys, loginRequired)
+	s.handler.DELETE("/auth/api-keys/:key_id", s.RevokeAPIKey, loginRequired)
+}
+
+func (s *Server) getAPIKeyUoW() *unitofwork.UnitOfWork[*apikeyapp.AtomicContext] {
+	return unitofwork.New[*apikeyapp.AtomicContext](
+		s.db,
+		apikeyapp.NewAtomicContext,
+		s.msgBus,
+		s.logger,
+	)
+}
+
+type APIKey struct {
+	KeyID      string     `json:"key_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func apiKeyFromModel(k *apikey.APIKey) APIKey {
+	return APIKey{
+		KeyID:      k.KeyID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=metrics:write metrics:read"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey
+	// Key is the secret itself. It is shown only once.
+	Key string `json:"key"`
+}
+
+func (s *Server) CreateAPIKey(c echo.Context) error {
+	var req CreateAPIKeyRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAPIKeyUoW()
+
+	k, secret, err := s.apiKeyService.CreateKey(c.Request().Context(), uow, user.UserID, req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, apikey.ErrInvalidScope) {
+			return JsonError(c, http.StatusBadRequest, err)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, CreateAPIKeyResponse{
+		APIKey: apiKeyFromModel(k),
+		Key:    secret,
+	})
+}
+
+type ListAPIKeysResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+func (s *Server) ListAPIKeys(c echo.Context) error {
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAPIKeyUoW()
+
+	keys, err := s.apiKeyService.ListKeys(c.Request().Context(), uow, user.UserID)
+	if err != nil {
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, ListAPIKeysResponse{
+		Keys: lo.Map(keys, func(k *apikey.APIKey, _ int) APIKey {
+			return apiKeyFromModel(k)
+		}),
+	})
+}
+
+type RevokeAPIKeyRequest struct {
+	KeyID string `param:"key_id" validate:"required,uuid"`
+}
+
+func (s *Server) RevokeAPIKey(c echo.Context) error {
+	var req RevokeAPIKeyRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAPIKeyUoW()
+
+	err := s.apiKeyService.RevokeKey(c.Request().Context(), uow, user.UserID, req.KeyID)
+	if err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) || errors.Is(err, apikey.ErrKeyRevoked) {
+			return JsonError(c, http.StatusNotFound, apikey.ErrKeyNotFound)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"net/http"
+	"time"
+)
+
+func (s *Server) MountAudit() {
+	loginRequired := s.LoginRequired()
+	s.handler.GET("/auth/audit", s.ListAuditLog, loginRequired)
+}
+
+func (s *Server) getAuditUoW() *unitofwork.UnitOfWork[*auditapp.AtomicContext] {
+	return unitofwork.New[*auditapp.AtomicContext](
+		s.db,
+		auditapp.NewAtomicContext,
+		s.msgBus,
+		s.logger,
+	)
+}
+
+type AuditEntry struct {
+	EntryID     int64             `json:"entry_id"`
+	UserID      string            `json:"user_id"`
+	ActorID     string            `json:"actor_id,omitempty"`
+	Action      string            `json:"action"`
+	IPAddress   string            `json:"ip_address,omitempty"`
+	Browser     string            `json:"browser,omitempty"`
+	OS          string            `json:"os,omitempty"`
+	DeviceModel string            `json:"device_model,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+type ListAuditLogRequest struct {
+	Action string `query:"action"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=200"`
+	Offset int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+type ListAuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+func (s *Server) ListAuditLog(c echo.Context) error {
+	var req ListAuditLogRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	filter := audit.Filter{
+		UserID: user.UserID,
+		Action: req.Action,
+		Limit:  defaultAuditLimit(req.Limit),
+		Offset: req.Offset,
+	}
+
+	entries, err := s.auditService.ListEntries(c.Request().Context(), s.getAuditUoW(), filter)
+	if err != nil {
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, ListAuditLogResponse{Entries: toAuditEntries(entries)})
+}
+
+func defaultAuditLimit(limit int) int {
+	if limit == 0 {
+		return 50
+	}
+	return limit
+}
+
+func toAuditEntries(entries []*audit.Entry) []AuditEntry {
+	return lo.Map(entries, func(e *audit.Entry, _ int) AuditEntry {
+		return AuditEntry{
+			EntryID:     e.EntryID,
+			UserID:      e.UserID,
+			ActorID:     e.ActorID,
+			Action:      e.Action,
+			IPAddress:   e.IPAddress,
+			Browser:     e.Browser,
+			OS:          e.OS,
+			DeviceModel: e.DeviceModel,
+			Details:     e.Details,
+			CreatedAt:   e.CreatedAt,
+		}
+	})
+}
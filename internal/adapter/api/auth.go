@@ -8,18 +8,46 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/mileusna/useragent"
 	"net/http"
-	"strings"
+	"net/netip"
 )
 
 func (s *Server) MountAuth() {
-	loginRequired := LoginRequired(s.authService.Authorizer)
+	loginRequired := s.LoginRequired()
+
+	s.handler.GET("/.well-known/jwks.json", s.JWKS)
 
 	authRoutes := s.handler.Group("/auth")
 
 	authRoutes.POST("/login", s.Login)
+	authRoutes.POST("/login/mfa", s.LoginSecondFactor)
+	authRoutes.POST("/login/magic-link", s.RequestMagicLink)
+	authRoutes.POST("/login/magic-link/confirm", s.LoginMagicLink)
 	authRoutes.POST("/sign-up", s.SignUp)
 	authRoutes.POST("/refresh", s.Refresh)
 	authRoutes.POST("/logout", s.Logout, loginRequired)
+
+	authRoutes.POST("/verify-email", s.VerifyEmail)
+	authRoutes.POST("/verify-email/resend", s.ResendEmailVerification, loginRequired)
+
+	authRoutes.POST("/mfa/totp", s.EnrollTOTP, loginRequired)
+	authRoutes.POST("/mfa/totp/confirm", s.ConfirmTOTP, loginRequired)
+	authRoutes.POST("/mfa/totp/disable", s.DisableTOTP, loginRequired)
+
+	authRoutes.POST("/password/forgot", s.ForgotPassword)
+	authRoutes.POST("/password/reset", s.ResetPassword)
+	authRoutes.PUT("/password", s.ChangePassword, loginRequired)
+
+	authRoutes.PUT("/email", s.ChangeEmail, loginRequired)
+	authRoutes.POST("/email/confirm", s.ConfirmEmailChange)
+	authRoutes.POST("/email/revert", s.RevertEmailChange)
+
+	authRoutes.GET("/sessions", s.ListSessions, loginRequired)
+	authRoutes.DELETE("/sessions", s.RevokeOtherSessions, loginRequired)
+	authRoutes.DELETE("/sessions/:session_id", s.RevokeSession, loginRequired)
+}
+
+func (s *Server) getAuthUoW() *unitofwork.UnitOfWork[*authapp.AtomicContext] {
+	return unitofwork.New[*authapp.AtomicContext](s.db, authapp.NewAtomicContext, s.msgBus, s.logger)
 }
 
 type loginReq struct {
@@ -28,8 +56,10 @@ type loginReq struct {
 }
 
 type loginResp struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
 func (s *Server) Login(c echo.Context) error {
@@ -38,39 +68,63 @@ func (s *Server) Login(c echo.Context) error {
 		return JsonError(c, http.StatusBadRequest, err)
 	}
 
-	agent := useragent.Parse(c.Request().UserAgent())
-
-	ipAddress := c.Request().RemoteAddr
-	if c.Request().Header.Get("X-Forwarded-For") != "" {
-		ipAddress = c.Request().Header.Get("X-Forwarded-For")
-	}
+	uow := s.getAuthUoW()
 
-	device := auth.Device{
-		Browser:   agent.Name,
-		OS:        agent.OS,
-		IPAddress: ipAddress,
-		Model:     agent.Device,
-	}
-
-	uow := unitofwork.New[*authapp.AtomicContext](s.db, authapp.NewAtomicContext, s.msgBus, s.logger)
-
-	tokens, err := s.authService.Login(c.Request().Context(), uow, device, b.Email, b.Password)
+	res, err := s.authService.Login(c.Request().Context(), uow, s.requestDevice(c), b.Email, b.Password)
 	if err != nil {
-		if errors.Is(err, auth.ErrInvalidCredentials) {
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrUserNotFound) {
 			return JsonError(c, http.StatusUnauthorized, "invalid email or password")
 		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return JsonError(c, http.StatusForbidden, "email is not verified")
+		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return JsonError(c, http.StatusForbidden, auth.ErrAccountLocked)
+		}
+		if ok, err := LoginThrottledError(c, err); ok {
+			return err
+		}
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
+
+	if res.MFAToken != "" {
+		return c.JSON(http.StatusOK, &loginResp{
+			MFARequired: true,
+			MFAToken:    res.MFAToken,
+		})
+	}
+
+	tokens := s.deliverTokens(c, res.Tokens)
 	return c.JSON(http.StatusOK, &loginResp{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
 	})
 }
 
+func (s *Server) requestDevice(c echo.Context) auth.Device {
+	agent := useragent.Parse(c.Request().UserAgent())
+
+	dev := auth.Device{
+		Browser:   agent.Name,
+		OS:        agent.OS,
+		IPAddress: c.RealIP(),
+		Model:     agent.Device,
+	}
+
+	if addr, err := netip.ParseAddr(dev.IPAddress); err == nil && s.geo != nil {
+		if n, ok := s.geo.Lookup(addr); ok {
+			dev.Country = n.Country
+			dev.ASN = n.ASN
+			dev.ASOrg = n.ASOrg
+		}
+	}
+	return dev
+}
+
 type signUpReq struct {
 	UserID   string `json:"user_id" validate:"required,uuid"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Password string `json:"password" validate:"required"`
 }
 
 func (s *Server) SignUp(c echo.Context) error {
@@ -79,11 +133,14 @@ func (s *Server) SignUp(c echo.Context) error {
 		return JsonError(c, http.StatusBadRequest, err)
 	}
 
-	uow := unitofwork.New[*authapp.AtomicContext](s.db, authapp.NewAtomicContext, s.msgBus, s.logger)
+	uow := s.getAuthUoW()
 
 	ctx := c.Request().Context()
 	_, err := s.authService.CreateUser(ctx, uow, b.UserID, b.Email, b.Password)
 	if err != nil {
+		if ok, err := PasswordPolicyError(c, err); ok {
+			return err
+		}
 		if errors.Is(err, auth.ErrUserExists) {
 			return JsonError(c, http.StatusBadRequest, "user already exists")
 		}
@@ -96,41 +153,48 @@ func (s *Server) SignUp(c echo.Context) error {
 func (s *Server) Logout(c echo.Context) error {
 	u := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
 
-	uow := unitofwork.New[*authapp.AtomicContext](s.db, authapp.NewAtomicContext, s.msgBus, s.logger)
+	uow := s.getAuthUoW()
 	if err := s.authService.Logout(c.Request().Context(), uow, u.UserID, u.Authorization); err != nil {
 		if errors.Is(err, auth.ErrUnauthorized) {
 			return JsonError(c, http.StatusUnauthorized, "unauthorized")
 		}
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
+	s.clearSessionCookies(c)
 	return c.NoContent(http.StatusNoContent)
 }
 
 type refreshResp struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 func (s *Server) Refresh(c echo.Context) error {
-	header := c.Request().Header.Get("Authorization")
-	parts := strings.Split(header, " ")
-	if len(parts) != 2 {
-		return JsonError(c, http.StatusBadRequest, "invalid authorization header")
+	token, fromCookie, err := s.credentials(c, "Refresh", RefreshTokenCookie)
+	if errors.Is(err, errInvalidCSRFToken) {
+		return JsonError(c, http.StatusForbidden, err)
 	}
-
-	if parts[0] != "Refresh" {
-		return JsonError(c, http.StatusBadRequest, "invalid authorization header")
+	if err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+	if !fromCookie && !s.headerTokensEnabled() {
+		return JsonError(c, http.StatusUnauthorized, errHeaderTokens)
 	}
 
-	uow := unitofwork.New[*authapp.AtomicContext](s.db, authapp.NewAtomicContext, s.msgBus, s.logger)
+	uow := s.getAuthUoW()
 	ctx := c.Request().Context()
-	tokens, err := s.authService.Refresh(ctx, uow, parts[1])
+	tokens, err := s.authService.Refresh(ctx, uow, token)
 	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			return JsonError(c, http.StatusUnauthorized, "refresh token reuse detected, session revoked")
+		}
 		if errors.Is(err, authapp.ErrInvalidAuthorization) {
-			return JsonError(c, http.StatusUnauthorized, err)
+			return JsonError(c, http.StatusUnauthorized, "invalid refresh token")
 		}
+		return JsonError(c, http.StatusInternalServerError, err)
 	}
 
+	tokens = s.deliverTokens(c, tokens)
 	return c.JSON(http.StatusOK, &refreshResp{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+)
+
+var (
+	errInvalidAuthHeader = errors.New("invalid authorization header")
+	errHeaderTokens      = errors.New("tokens must be sent in cookies")
+	errInvalidCSRFToken  = errors.New("invalid csrf token")
+)
+
+// CookieSession makes the server deliver tokens in HttpOnly cookies, so
+// browsers never expose them to scripts. Requests authenticated with cookies
+// must repeat the value of the csrf_token cookie in the X-CSRF-Token header
+// unless the method is safe.
+type CookieSession struct {
+	// HeaderTokens keeps the header scheme working alongside cookies: tokens
+	// are returned in response bodies and accepted in the Authorization
+	// header as well.
+	HeaderTokens bool
+	Domain       string
+	Secure       bool
+	SameSite     http.SameSite
+}
+
+func (s *Server) headerTokensEnabled() bool {
+	return s.cookies == nil || s.cookies.HeaderTokens
+}
+
+// secureCookies reports whether cookies must be marked Secure. Without the
+// cookie session configured it follows the scheme of the request.
+func (s *Server) secureCookies(c echo.Context) bool {
+	if s.cookies == nil {
+		return c.Scheme() == "https"
+	}
+	return s.cookies.Secure
+}
+
+// credentials returns the token sent with the header scheme or, if there is
+// no Authorization header, the token from the cookie.
+func (s *Server) credentials(c echo.Context, scheme string, cookie string) (token string, fromCookie bool, err error) {
+	if header := c.Request().Header.Get("Authorization"); header != "" || s.cookies == nil {
+		parts := strings.Split(header, " ")
+		if len(parts) != 2 || parts[0] != scheme {
+			return "", false, errInvalidAuthHeader
+		}
+		return parts[1], false, nil
+	}
+
+	ck, err := c.Cookie(cookie)
+	if err != nil || ck.Value == "" {
+		return "", false, errInvalidAuthHeader
+	}
+	if !isSafeMethod(c.Request().Method) && !validCSRFToken(c) {
+		return "", true, errInvalidCSRFToken
+	}
+	return ck.Value, true, nil
+}
+
+func validCSRFToken(c echo.Context) bool {
+	ck, err := c.Cookie(CSRFTokenCookie)
+	if err != nil || ck.Value == "" {
+		return false
+	}
+	header := c.Request().Header.Get(CSRFTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(ck.Value), []byte(header)) == 1
+}
+
+// deliverTokens sets the session cookies and returns the tokens that go to
+// the response body.
+func (s *Server) deliverTokens(c echo.Context, tokens authapp.Tokens) authapp.Tokens {
+	if s.cookies == nil {
+		return tokens
+	}
+
+	authorizer := s.authService.Authorizer
+	c.SetCookie(s.sessionCookie(AccessTokenCookie, tokens.AccessToken, "/", int(authorizer.AccessTokenTTL.Seconds()), true))
+	c.SetCookie(s.sessionCookie(RefreshTokenCookie, tokens.RefreshToken, "/auth", int(authorizer.AuthorizationTTL.Seconds()), true))
+	c.SetCookie(s.sessionCookie(CSRFTokenCookie, newCSRFToken(), "/", int(authorizer.AuthorizationTTL.Seconds()), false))
+
+	if s.cookies.HeaderTokens {
+		return tokens
+	}
+	return authapp.Tokens{}
+}
+
+func (s *Server) clearSessionCookies(c echo.Context) {
+	if s.cookies == nil {
+		return
+	}
+	c.SetCookie(s.sessionCookie(AccessTokenCookie, "", "/", -1, true))
+	c.SetCookie(s.sessionCookie(RefreshTokenCookie, "", "/auth", -1, true))
+	c.SetCookie(s.sessionCookie(CSRFTokenCookie, "", "/", -1, false))
+}
+
+// The CSRF cookie is the only one scripts can read: they have to copy it to
+// the header.
+func (s *Server) sessionCookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.cookies.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   s.cookies.Secure,
+		SameSite: s.cookies.SameSite,
+	}
+}
+
+func newCSRFToken() string {
+	var bytes [32]byte
+	if n, err := rand.Read(bytes[:]); n != len(bytes) || err != nil {
+		panic("failed to generate csrf token")
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes[:])
+}
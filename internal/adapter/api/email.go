@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type ChangeEmailRequest struct {
+	NewEmail    string `json:"new_email" validate:"required,email"`
+	Password    string `json:"password" validate:"required_without=ReauthToken"`
+	ReauthToken string `json:"reauth_token"`
+}
+
+func (s *Server) ChangeEmail(c echo.Context) error {
+	var req ChangeEmailRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	reauth, err := s.authService.Reauthentication(user.UserID, req.Password, req.ReauthToken)
+	if err != nil {
+		return JsonError(c, http.StatusUnauthorized, err)
+	}
+
+	uow := s.getAuthUoW()
+	err = s.authService.RequestEmailChange(
+		c.Request().Context(),
+		uow,
+		user.UserID,
+		user.Authorization,
+		reauth,
+		req.NewEmail,
+	)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return JsonError(c, http.StatusBadRequest, "password is invalid")
+		}
+		if errors.Is(err, auth.ErrReauthenticationRequired) {
+			return JsonError(c, http.StatusUnauthorized, auth.ErrReauthenticationRequired)
+		}
+		if errors.Is(err, auth.ErrEmailUnchanged) {
+			return JsonError(c, http.StatusBadRequest, auth.ErrEmailUnchanged)
+		}
+		if errors.Is(err, auth.ErrUserEmailDuplicate) {
+			return JsonError(c, http.StatusConflict, "email is already taken")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (s *Server) ConfirmEmailChange(c echo.Context) error {
+	return s.applyEmailChange(c, s.authService.ConfirmEmailChange)
+}
+
+func (s *Server) RevertEmailChange(c echo.Context) error {
+	return s.applyEmailChange(c, s.authService.RevertEmailChange)
+}
+
+type emailChangeFunc func(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*authapp.AtomicContext],
+	token string,
+) error
+
+func (s *Server) applyEmailChange(c echo.Context, apply emailChangeFunc) error {
+	var req EmailChangeTokenRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	if err := apply(c.Request().Context(), s.getAuthUoW(), req.Token); err != nil {
+		if errors.Is(err, auth.ErrEmailChangeInvalid) {
+			return JsonError(c, http.StatusBadRequest, auth.ErrEmailChangeInvalid)
+		}
+		if errors.Is(err, auth.ErrUserEmailDuplicate) {
+			return JsonError(c, http.StatusConflict, "email is already taken")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
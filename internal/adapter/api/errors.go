@@ -1,8 +1,16 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"github.com/burenotti/go_health_backend/internal/app/passwordpolicy"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
 	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
 )
 
 type JsonErrorModel struct {
@@ -13,3 +21,42 @@ func JsonError(c echo.Context, status int, content any) error {
 	data := &JsonErrorModel{Message: fmt.Sprintf("%v", content)}
 	return c.JSON(status, data)
 }
+
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicyErrorModel struct {
+	Message    string              `json:"message"`
+	Violations []PasswordViolation `json:"violations"`
+}
+
+// PasswordPolicyError responds with the rules the password broke. It reports
+// false when err is not a policy error.
+func PasswordPolicyError(c echo.Context, err error) (bool, error) {
+	var policyErr *passwordpolicy.Error
+	if !errors.As(err, &policyErr) {
+		return false, nil
+	}
+
+	return true, c.JSON(http.StatusUnprocessableEntity, &PasswordPolicyErrorModel{
+		Message: policyErr.Error(),
+		Violations: lo.Map(policyErr.Violations, func(v passwordpolicy.Violation, _ int) PasswordViolation {
+			return PasswordViolation{Rule: v.Rule, Message: v.Message}
+		}),
+	})
+}
+
+// LoginThrottledError responds with 429 and the Retry-After header. It
+// reports false when err is not a throttling error.
+func LoginThrottledError(c echo.Context, err error) (bool, error) {
+	var throttled *auth.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false, nil
+	}
+
+	retryAfter := int(math.Ceil(time.Until(throttled.RetryAt).Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	return true, JsonError(c, http.StatusTooManyRequests, auth.ErrLoginThrottled)
+}
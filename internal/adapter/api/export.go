@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
+	exportapp "github.com/burenotti/go_health_backend/internal/app/export"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/export"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func (s *Server) MountExports() {
+	loginRequired := s.LoginRequired()
+	s.handler.POST("/exports", s.RequestExport, loginRequired)
+	s.handler.GET("/exports/download", s.DownloadExport)
+	s.handler.GET("/exports/:export_id", s.GetExport, loginRequired)
+}
+
+func (s *Server) getExportUoW() *unitofwork.UnitOfWork[*exportapp.AtomicContext] {
+	return unitofwork.New[*exportapp.AtomicContext](
+		s.db,
+		exportapp.NewAtomicContext,
+		s.msgBus,
+		s.logger,
+	)
+}
+
+type ExportResponse struct {
+	ExportID    string     `json:"export_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func (s *Server) RequestExport(c echo.Context) error {
+	uow := s.getExportUoW()
+
+	e, err := s.exportService.RequestExport(c.Request().Context(), uow, currentSubject(c))
+	if err != nil {
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, "only trainees can export their data")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusAccepted, ExportResponse{
+		ExportID:  e.ExportID,
+		Status:    e.Status,
+		CreatedAt: e.CreatedAt,
+	})
+}
+
+type GetExportRequest struct {
+	ExportID string `param:"export_id" validate:"required,uuid"`
+}
+
+func (s *Server) GetExport(c echo.Context) error {
+	var req GetExportRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getExportUoW()
+	e, token, err := s.exportService.GetExport(c.Request().Context(), uow, currentSubject(c), req.ExportID)
+	if err != nil {
+		if errors.Is(err, export.ErrExportNotFound) {
+			return JsonError(c, http.StatusNotFound, err)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	resp := ExportResponse{
+		ExportID:    e.ExportID,
+		Status:      e.Status,
+		CreatedAt:   e.CreatedAt,
+		CompletedAt: e.CompletedAt,
+		ExpiresAt:   e.ExpiresAt,
+	}
+	if token != "" {
+		resp.DownloadURL = "/exports/download?" + url.Values{"token": {token}}.Encode()
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+type DownloadExportRequest struct {
+	Token string `query:"token" validate:"required"`
+}
+
+func (s *Server) DownloadExport(c echo.Context) error {
+	var req DownloadExportRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getExportUoW()
+	archive, err := s.exportService.DownloadExport(c.Request().Context(), uow, req.Token)
+	if err != nil {
+		if errors.Is(err, authapp.ErrLinkInvalid) || errors.Is(err, export.ErrExportNotFound) {
+			return JsonError(c, http.StatusNotFound, "export not found")
+		}
+		if errors.Is(err, export.ErrExportExpired) {
+			return JsonError(c, http.StatusGone, err)
+		}
+		if errors.Is(err, export.ErrExportNotReady) {
+			return JsonError(c, http.StatusConflict, err)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="gohealth-export.zip"`)
+	return c.Blob(http.StatusOK, "application/zip", archive)
+}
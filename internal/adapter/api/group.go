@@ -3,16 +3,18 @@ package api
 import (
 	"errors"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	groupservice "github.com/burenotti/go_health_backend/internal/app/group"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/domain/group"
 	"github.com/labstack/echo/v4"
 	"github.com/samber/lo"
 	"net/http"
+	"time"
 )
 
 func (s *Server) MountGroups() {
-	loginRequired := LoginRequired(s.authService.Authorizer)
+	loginRequired := s.LoginRequired()
 	groupsGroup := s.handler.Group("/groups", loginRequired)
 
 	groupsGroup.GET("/list", s.GetGroupsList)
@@ -46,13 +48,16 @@ func (s *Server) CreateGroup(c echo.Context) error {
 	ctx := c.Request().Context()
 	groupId := group.GroupID(req.GroupID)
 	coachId := group.CoachID(user.UserID)
-	err := s.groupService.CreateGroup(ctx, uow, groupId, coachId, req.Name, req.Description)
+	err := s.groupService.CreateGroup(ctx, uow, currentSubject(c), groupId, coachId, req.Name, req.Description)
 
 	if err != nil {
 
 		if errors.Is(err, group.ErrGroupExists) {
 			return JsonError(c, http.StatusBadRequest, err)
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, "only coaches can create groups")
+		}
 
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
@@ -64,10 +69,11 @@ type GetGroupRequest struct {
 }
 
 type GetGroupResponse struct {
-	GroupID     string `json:"group_id"`
-	CoachID     string `json:"coach_id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	GroupID     string     `json:"group_id"`
+	CoachID     string     `json:"coach_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
 }
 
 func (s *Server) GetGroup(c echo.Context) error {
@@ -78,12 +84,15 @@ func (s *Server) GetGroup(c echo.Context) error {
 
 	uow := s.getGroupUoW()
 
-	g, err := s.groupService.GetByID(c.Request().Context(), uow, group.GroupID(req.GroupID))
+	g, err := s.groupService.GetByID(c.Request().Context(), uow, currentSubject(c), group.GroupID(req.GroupID))
 
 	if err != nil {
 		if errors.Is(err, group.ErrGroupNotFound) {
 			return JsonError(c, http.StatusNotFound, err)
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, err)
+		}
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
 	return c.JSON(http.StatusOK, GetGroupResponse{
@@ -91,6 +100,7 @@ func (s *Server) GetGroup(c echo.Context) error {
 		CoachID:     string(g.CoachID),
 		Name:        g.Name,
 		Description: g.Description,
+		ArchivedAt:  g.ArchivedAt,
 	})
 }
 
@@ -121,12 +131,15 @@ func (s *Server) GetGroupMembers(c echo.Context) error {
 
 	ctx := c.Request().Context()
 	groupId := group.GroupID(req.GroupID)
-	members, err := s.groupService.GetMembers(ctx, uow, groupId, req.Limit, req.Offset)
+	members, err := s.groupService.GetMembers(ctx, uow, currentSubject(c), groupId, req.Limit, req.Offset)
 
 	if err != nil {
 		if errors.Is(err, group.ErrGroupNotFound) {
 			return JsonError(c, http.StatusNotFound, err)
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, err)
+		}
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
 
@@ -145,10 +158,11 @@ func (s *Server) GetGroupMembers(c echo.Context) error {
 }
 
 type Group struct {
-	GroupID     string `json:"group_id"`
-	CoachID     string `json:"coach_id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	GroupID     string     `json:"group_id"`
+	CoachID     string     `json:"coach_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
 }
 
 type GetGroupsListRequest struct {
@@ -182,6 +196,7 @@ func (s *Server) GetGroupsList(c echo.Context) error {
 				CoachID:     string(item.CoachID),
 				Name:        item.Name,
 				Description: item.Description,
+				ArchivedAt:  item.ArchivedAt,
 			}
 		}),
 	})
@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/geoip"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	accountapp "github.com/burenotti/go_health_backend/internal/app/account"
+	adminapp "github.com/burenotti/go_health_backend/internal/app/admin"
+	apikeyapp "github.com/burenotti/go_health_backend/internal/app/apikey"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	exportapp "github.com/burenotti/go_health_backend/internal/app/export"
 	groupservice "github.com/burenotti/go_health_backend/internal/app/group"
 	inviteservice "github.com/burenotti/go_health_backend/internal/app/invite"
 	metricservice "github.com/burenotti/go_health_backend/internal/app/metric"
+	onboardingapp "github.com/burenotti/go_health_backend/internal/app/onboarding"
 	profileapp "github.com/burenotti/go_health_backend/internal/app/profile"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/go-playground/validator/v10"
@@ -19,17 +26,28 @@ import (
 )
 
 type Server struct {
-	handler        *echo.Echo
-	logger         *slog.Logger
-	addr           string
-	db             storage.DB
-	authService    *authapp.Service
-	profileService *profileapp.Service
-	groupService   *groupservice.Service
-	inviteService  *inviteservice.Service
-	metricService  *metricservice.Service
-	msgBus         unitofwork.MessageBus
-	validator      *validator.Validate
+	handler           *echo.Echo
+	logger            *slog.Logger
+	addr              string
+	db                storage.DB
+	authService       *authapp.Service
+	profileService    *profileapp.Service
+	groupService      *groupservice.Service
+	inviteService     *inviteservice.Service
+	metricService     *metricservice.Service
+	accountService    *accountapp.Service
+	exportService     *exportapp.Service
+	apiKeyService     *apikeyapp.Service
+	auditService      *auditapp.Service
+	adminService      *adminapp.Service
+	onboardingService *onboardingapp.Service
+	msgBus            unitofwork.MessageBus
+	revocations       *authapp.RevocationList
+	geo               *geoip.Database
+	cookies           *CookieSession
+
+	verifiedEmailRoutes []string
+	validator           *validator.Validate
 }
 
 func NewServer(opt ...Option) *Server {
@@ -41,6 +59,8 @@ func NewServer(opt ...Option) *Server {
 	e.Server.IdleTimeout = 10 * time.Second
 	e.Server.ReadHeaderTimeout = 5 * time.Second
 	e.Server.MaxHeaderBytes = 4096
+	// Forwarding headers are ignored unless trusted proxies are configured.
+	e.IPExtractor = echo.ExtractIPDirect()
 
 	v := validator.New(validator.WithRequiredStructEnabled())
 
@@ -68,10 +88,17 @@ func NewServer(opt ...Option) *Server {
 
 func (s *Server) Mount() {
 	s.MountAuth()
+	s.MountExternalAuth()
 	s.MountProfile()
+	s.MountOnboarding()
 	s.MountGroups()
 	s.MountInvites()
 	s.MountMetrics()
+	s.MountAccount()
+	s.MountExports()
+	s.MountAPIKeys()
+	s.MountAudit()
+	s.MountAdmin()
 }
 
 func (s *Server) Start() error {
@@ -3,8 +3,10 @@ package api
 import (
 	"errors"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	inviteservice "github.com/burenotti/go_health_backend/internal/app/invite"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
 	"github.com/burenotti/go_health_backend/internal/domain/invite"
 	"github.com/labstack/echo/v4"
 	"net/http"
@@ -12,7 +14,7 @@ import (
 )
 
 func (s *Server) MountInvites() {
-	loginRequired := LoginRequired(s.authService.Authorizer)
+	loginRequired := s.LoginRequired()
 	s.handler.POST("/groups/:group_id/invites", s.CreateInvite, loginRequired)
 	s.handler.POST("/invites/accept", s.AcceptInvite, loginRequired)
 
@@ -47,13 +49,19 @@ func (s *Server) CreateInvite(c echo.Context) error {
 	ctx := c.Request().Context()
 	groupId := invite.GroupID(req.GroupID)
 
-	inv, err := s.inviteService.CreateInvite(ctx, uow, groupId)
+	inv, err := s.inviteService.CreateInvite(ctx, uow, currentSubject(c), groupId)
 
 	if err != nil {
 
 		if errors.Is(err, invite.ErrInviteExists) {
 			return JsonError(c, http.StatusBadRequest, err)
 		}
+		if errors.Is(err, group.ErrGroupNotFound) {
+			return JsonError(c, http.StatusNotFound, err)
+		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, err)
+		}
 
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
@@ -78,12 +86,15 @@ func (s *Server) AcceptInvite(c echo.Context) error {
 	ctx := c.Request().Context()
 	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
 
-	err := s.inviteService.AcceptInvite(ctx, uow, invite.TraineeID(user.UserID), req.Secret)
+	err := s.inviteService.AcceptInvite(ctx, uow, currentSubject(c), invite.TraineeID(user.UserID), req.Secret)
 
 	if err != nil {
 		if errors.Is(err, invite.ErrInviteExpired) {
 			return JsonError(c, http.StatusBadRequest, err)
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, "only trainees can accept invites")
+		}
 
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"net/http"
+)
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (s *Server) JWKS(c echo.Context) error {
+	keys := s.authService.Authorizer.Keys.PublicKeys()
+
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, JWKSResponse{
+		Keys: lo.Map(keys, func(k authapp.JWK, _ int) JWK {
+			return JWK{
+				KeyType:   k.KeyType,
+				KeyID:     k.KeyID,
+				Use:       "sig",
+				Algorithm: k.Algorithm,
+				Curve:     k.Curve,
+				N:         k.N,
+				E:         k.E,
+				X:         k.X,
+			}
+		}),
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// magicLinkNonceCookie binds the link to the browser it was requested from.
+// Only that browser can exchange the link for a session.
+const magicLinkNonceCookie = "magic_link_nonce"
+
+type RequestMagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (s *Server) RequestMagicLink(c echo.Context) error {
+	var req RequestMagicLinkRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getAuthUoW()
+	nonce, err := s.authService.RequestMagicLink(c.Request().Context(), uow, s.requestDevice(c), req.Email)
+	if err != nil {
+		if ok, err := LoginThrottledError(c, err); ok {
+			return err
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	c.SetCookie(s.magicLinkNonceCookie(c, nonce, 0))
+	return c.NoContent(http.StatusAccepted)
+}
+
+type LoginMagicLinkRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// LoginMagicLink expects the token to be posted by the page the link opens,
+// so link previews and mail scanners don't use it up.
+func (s *Server) LoginMagicLink(c echo.Context) error {
+	var req LoginMagicLinkRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	var nonce string
+	if cookie, err := c.Cookie(magicLinkNonceCookie); err == nil {
+		nonce = cookie.Value
+	}
+
+	uow := s.getAuthUoW()
+	res, err := s.authService.CompleteMagicLink(c.Request().Context(), uow, s.requestDevice(c), req.Token, nonce)
+	if err != nil {
+		if ok, err := LoginThrottledError(c, err); ok {
+			return err
+		}
+		if errors.Is(err, auth.ErrMagicLinkOtherDevice) {
+			return JsonError(c, http.StatusForbidden, auth.ErrMagicLinkOtherDevice)
+		}
+		if errors.Is(err, auth.ErrMagicLinkInvalid) {
+			return JsonError(c, http.StatusUnauthorized, auth.ErrMagicLinkInvalid)
+		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return JsonError(c, http.StatusForbidden, auth.ErrAccountLocked)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	c.SetCookie(s.magicLinkNonceCookie(c, "", -1))
+	if res.MFAToken != "" {
+		return c.JSON(http.StatusOK, &loginResp{
+			MFARequired: true,
+			MFAToken:    res.MFAToken,
+		})
+	}
+
+	tokens := s.deliverTokens(c, res.Tokens)
+	return c.JSON(http.StatusOK, &loginResp{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+func (s *Server) magicLinkNonceCookie(c echo.Context, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Value:    value,
+		Path:     "/auth/login/magic-link",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.secureCookies(c),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -3,8 +3,10 @@ package api
 import (
 	"errors"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	metricservice "github.com/burenotti/go_health_backend/internal/app/metric"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/apikey"
 	"github.com/burenotti/go_health_backend/internal/domain/metric"
 	"github.com/labstack/echo/v4"
 	"github.com/samber/lo"
@@ -13,10 +15,11 @@ import (
 )
 
 func (s *Server) MountMetrics() {
-	loginRequired := LoginRequired(s.authService.Authorizer)
-	s.handler.POST("/metrics/:metric_id", s.CreateMetric, loginRequired)
-	s.handler.GET("/metrics/:metric_id", s.GetMetric, loginRequired)
-	s.handler.GET("/metrics/list/:trainee_id", s.ListMetrics, loginRequired)
+	writeRequired := s.LoginRequired(apikey.ScopeMetricsWrite)
+	readRequired := s.LoginRequired(apikey.ScopeMetricsRead)
+	s.handler.POST("/metrics/:metric_id", s.CreateMetric, writeRequired)
+	s.handler.GET("/metrics/:metric_id", s.GetMetric, readRequired)
+	s.handler.GET("/metrics/list/:trainee_id", s.ListMetrics, readRequired)
 }
 
 func (s *Server) getMetricsUoW() *unitofwork.UnitOfWork[*metricservice.AtomicContext] {
@@ -44,11 +47,23 @@ func (s *Server) CreateMetric(c echo.Context) error {
 	ctx := c.Request().Context()
 	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
 
-	err := s.metricService.CreateMetric(ctx, uow, req.MetricID, user.UserID, req.HeartRate, req.Weight, req.Height)
+	err := s.metricService.CreateMetric(
+		ctx,
+		uow,
+		currentSubject(c),
+		req.MetricID,
+		user.UserID,
+		req.HeartRate,
+		req.Weight,
+		req.Height,
+	)
 	if err != nil {
 		if errors.Is(err, metric.ErrMetricExists) {
 			return JsonError(c, http.StatusBadRequest, err)
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, "only trainees can record metrics")
+		}
 
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
@@ -77,10 +92,13 @@ func (s *Server) GetMetric(c echo.Context) error {
 	uow := s.getMetricsUoW()
 	ctx := c.Request().Context()
 
-	m, err := s.metricService.GetMetricByID(ctx, uow, req.MetricID)
+	m, err := s.metricService.GetMetricByID(ctx, uow, currentSubject(c), req.MetricID)
 	if err != nil {
-		if errors.Is(err, metric.ErrMetricExists) {
-			return JsonError(c, http.StatusBadRequest, err)
+		if errors.Is(err, metric.ErrMetricNotFound) {
+			return JsonError(c, http.StatusNotFound, err)
+		}
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, err)
 		}
 
 		return JsonError(c, http.StatusInternalServerError, err)
@@ -120,12 +138,11 @@ func (s *Server) ListMetrics(c echo.Context) error {
 	}
 	uow := s.getMetricsUoW()
 	ctx := c.Request().Context()
-	//user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
 
-	lst, err := s.metricService.ListMetricByTrainee(ctx, uow, req.TraineeID)
+	lst, err := s.metricService.ListMetricByTrainee(ctx, uow, currentSubject(c), req.TraineeID)
 	if err != nil {
-		if errors.Is(err, metric.ErrMetricExists) {
-			return JsonError(c, http.StatusBadRequest, err)
+		if errors.Is(err, authz.ErrForbidden) {
+			return JsonError(c, http.StatusForbidden, err)
 		}
 
 		return JsonError(c, http.StatusInternalServerError, err)
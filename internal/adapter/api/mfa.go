@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type LoginSecondFactorRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+func (s *Server) LoginSecondFactor(c echo.Context) error {
+	var req LoginSecondFactorRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getAuthUoW()
+	ctx := c.Request().Context()
+
+	tokens, err := s.authService.CompleteSecondFactor(ctx, uow, s.requestDevice(c), req.MFAToken, req.Code)
+	if err != nil {
+		if ok, err := LoginThrottledError(c, err); ok {
+			return err
+		}
+		if errors.Is(err, auth.ErrInvalidSecondFactor) {
+			return JsonError(c, http.StatusUnauthorized, auth.ErrInvalidSecondFactor)
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) ||
+			errors.Is(err, auth.ErrSecondFactorDisabled) ||
+			errors.Is(err, auth.ErrChallengeInvalid) {
+			return JsonError(c, http.StatusUnauthorized, "invalid mfa token")
+		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return JsonError(c, http.StatusForbidden, auth.ErrAccountLocked)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	tokens = s.deliverTokens(c, tokens)
+	return c.JSON(http.StatusOK, &loginResp{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func (s *Server) EnrollTOTP(c echo.Context) error {
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+
+	enrollment, err := s.authService.EnrollTOTP(c.Request().Context(), uow, user.UserID)
+	if err != nil {
+		if errors.Is(err, auth.ErrSecondFactorEnabled) {
+			return JsonError(c, http.StatusConflict, auth.ErrSecondFactorEnabled)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, EnrollTOTPResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (s *Server) ConfirmTOTP(c echo.Context) error {
+	var req TOTPCodeRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+
+	codes, err := s.authService.ConfirmTOTP(c.Request().Context(), uow, user.UserID, req.Code)
+	if err != nil {
+		return s.secondFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, ConfirmTOTPResponse{RecoveryCodes: codes})
+}
+
+type DisableTOTPRequest struct {
+	Code        string `json:"code" validate:"required"`
+	Password    string `json:"password" validate:"required_without=ReauthToken"`
+	ReauthToken string `json:"reauth_token"`
+}
+
+func (s *Server) DisableTOTP(c echo.Context) error {
+	var req DisableTOTPRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	reauth, err := s.authService.Reauthentication(user.UserID, req.Password, req.ReauthToken)
+	if err != nil {
+		return JsonError(c, http.StatusUnauthorized, err)
+	}
+
+	uow := s.getAuthUoW()
+	if err := s.authService.DisableTOTP(c.Request().Context(), uow, user.UserID, reauth, req.Code); err != nil {
+		return s.secondFactorError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) secondFactorError(c echo.Context, err error) error {
+	if ok, err := LoginThrottledError(c, err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return JsonError(c, http.StatusBadRequest, "password is invalid")
+	case errors.Is(err, auth.ErrReauthenticationRequired):
+		return JsonError(c, http.StatusUnauthorized, auth.ErrReauthenticationRequired)
+	case errors.Is(err, auth.ErrInvalidSecondFactor):
+		return JsonError(c, http.StatusBadRequest, auth.ErrInvalidSecondFactor)
+	case errors.Is(err, auth.ErrSecondFactorEnabled):
+		return JsonError(c, http.StatusConflict, auth.ErrSecondFactorEnabled)
+	case errors.Is(err, auth.ErrSecondFactorDisabled):
+		return JsonError(c, http.StatusConflict, auth.ErrSecondFactorDisabled)
+	default:
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+}
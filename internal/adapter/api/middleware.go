@@ -1,29 +1,67 @@
 package api
 
 import (
+	"errors"
+	apikeyapp "github.com/burenotti/go_health_backend/internal/app/apikey"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
 	"net/http"
 	"strings"
 )
 
 const KeyCurrentUser = "current_user"
 
-func LoginRequired(authorizer *authapp.Authorizer) echo.MiddlewareFunc {
+// LoginRequired authenticates the request with an access token from the
+// Authorization header or, in the cookie session mode, from the cookie. API
+// keys are accepted only on routes listing a scope the key was issued with.
+// Impersonation tokens are always accepted in the header.
+func (s *Server) LoginRequired(scopes ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			header := c.Request().Header.Get("Authorization")
-			parts := strings.Split(header, " ")
-			if len(parts) != 2 {
-				return JsonError(c, http.StatusUnprocessableEntity, "Invalid Authorization header")
+			token, fromCookie, err := s.credentials(c, "Bearer", AccessTokenCookie)
+			if errors.Is(err, errInvalidCSRFToken) {
+				return JsonError(c, http.StatusForbidden, err)
 			}
-			if parts[0] != "Bearer" {
+			if err != nil {
 				return JsonError(c, http.StatusUnprocessableEntity, "Invalid Authorization header")
 			}
-			user, err := authorizer.ValidateAccessToken(parts[1])
+			if !fromCookie && apikeyapp.IsKey(token) {
+				return s.keyRequired(c, next, token, scopes)
+			}
+			user, err := s.authService.Authorizer.ValidateAccessToken(token)
 			if err != nil {
 				return JsonError(c, http.StatusUnauthorized, err.Error())
 			}
+			// Impersonation tokens are handed to the admin in the response body
+			// and can't be sent in cookies.
+			if !fromCookie && !s.headerTokensEnabled() && !user.IsImpersonated() {
+				return JsonError(c, http.StatusUnauthorized, errHeaderTokens)
+			}
+			if s.revocations != nil {
+				revoked, err := s.revocations.IsRevoked(c.Request().Context(), user.Authorization)
+				if err != nil {
+					return JsonError(c, http.StatusInternalServerError, err)
+				}
+				if revoked {
+					return JsonError(c, http.StatusUnauthorized, "access token revoked")
+				}
+			}
+			if !user.EmailVerified && s.requiresVerifiedEmail(c.Path()) {
+				return JsonError(c, http.StatusForbidden, "email is not verified")
+			}
+			if user.IsImpersonated() {
+				s.logger.Info("impersonated request",
+					"actor_id", user.ActorID,
+					"user_id", user.UserID,
+					"method", c.Request().Method,
+					"path", c.Request().URL.Path,
+				)
+				if !isSafeMethod(c.Request().Method) {
+					return JsonError(c, http.StatusForbidden, "write operations are not allowed while impersonating")
+				}
+			}
 			c.Set(KeyCurrentUser, user)
 			if err := next(c); err != nil {
 				c.Error(err)
@@ -32,3 +70,52 @@ func LoginRequired(authorizer *authapp.Authorizer) echo.MiddlewareFunc {
 		}
 	}
 }
+
+func (s *Server) keyRequired(c echo.Context, next echo.HandlerFunc, secret string, scopes []string) error {
+	if s.apiKeyService == nil {
+		return JsonError(c, http.StatusUnauthorized, apikeyapp.ErrInvalidKey)
+	}
+
+	k, u, err := s.apiKeyService.Authenticate(c.Request().Context(), s.getAPIKeyUoW(), secret)
+	if err != nil {
+		if errors.Is(err, apikeyapp.ErrInvalidKey) {
+			return JsonError(c, http.StatusUnauthorized, err)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	if !lo.SomeBy(scopes, k.HasScope) {
+		return JsonError(c, http.StatusForbidden, "api key is not allowed to access this route")
+	}
+	if !u.IsVerified() && s.requiresVerifiedEmail(c.Path()) {
+		return JsonError(c, http.StatusForbidden, "email is not verified")
+	}
+
+	c.Set(KeyCurrentUser, &authapp.AccessTokenData{
+		UserID:        u.UserID,
+		EmailVerified: u.IsVerified(),
+		APIKey:        k.KeyID,
+	})
+	if err := next(c); err != nil {
+		c.Error(err)
+	}
+	return nil
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func currentSubject(c echo.Context) authz.Subject {
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	return authz.Subject{UserID: user.UserID}
+}
+
+func (s *Server) requiresVerifiedEmail(path string) bool {
+	for _, prefix := range s.verifiedEmailRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/oidc"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+const externalStateCookie = "oidc_state"
+
+func (s *Server) MountExternalAuth() {
+	authRoutes := s.handler.Group("/auth/oidc")
+
+	authRoutes.GET("/:provider", s.StartExternalLogin)
+	authRoutes.GET("/:provider/callback", s.ExternalLoginCallback)
+	authRoutes.POST("/:provider/reauth", s.StartReauthentication, s.LoginRequired())
+}
+
+type StartExternalLoginRequest struct {
+	Provider string `param:"provider" validate:"required"`
+}
+
+func (s *Server) StartExternalLogin(c echo.Context) error {
+	var req StartExternalLoginRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	login, err := s.authService.StartExternalLogin(c.Request().Context(), req.Provider)
+	if err != nil {
+		if errors.Is(err, authapp.ErrUnknownProvider) {
+			return JsonError(c, http.StatusNotFound, err)
+		}
+		if errors.Is(err, oidc.ErrProviderUnavailable) {
+			return JsonError(c, http.StatusBadGateway, oidc.ErrProviderUnavailable)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	c.SetCookie(s.externalStateCookie(c, login.StateToken, 0))
+	return c.Redirect(http.StatusFound, login.RedirectURL)
+}
+
+type StartReauthenticationResponse struct {
+	RedirectURL string `json:"redirect_url"`
+}
+
+// StartReauthentication is called by users without a password before
+// deleting the account or changing the email. The client follows the
+// returned URL; the callback responds with a reauthentication token.
+func (s *Server) StartReauthentication(c echo.Context) error {
+	var req StartExternalLoginRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	login, err := s.authService.StartReauthentication(c.Request().Context(), user.UserID, req.Provider)
+	if err != nil {
+		if errors.Is(err, authapp.ErrUnknownProvider) {
+			return JsonError(c, http.StatusNotFound, err)
+		}
+		if errors.Is(err, oidc.ErrProviderUnavailable) {
+			return JsonError(c, http.StatusBadGateway, oidc.ErrProviderUnavailable)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	c.SetCookie(s.externalStateCookie(c, login.StateToken, 0))
+	return c.JSON(http.StatusOK, &StartReauthenticationResponse{RedirectURL: login.RedirectURL})
+}
+
+type ReauthenticationResponse struct {
+	ReauthToken string `json:"reauth_token"`
+}
+
+type ExternalLoginCallbackRequest struct {
+	Provider         string `param:"provider" validate:"required"`
+	Code             string `query:"code"`
+	State            string `query:"state"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+}
+
+func (s *Server) ExternalLoginCallback(c echo.Context) error {
+	var req ExternalLoginCallbackRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	var stateToken string
+	if cookie, err := c.Cookie(externalStateCookie); err == nil {
+		stateToken = cookie.Value
+	}
+	c.SetCookie(s.externalStateCookie(c, "", -1))
+
+	if req.Error != "" {
+		return JsonError(c, http.StatusUnauthorized, req.Error+": "+req.ErrorDescription)
+	}
+	if req.Code == "" || req.State == "" || stateToken == "" {
+		return JsonError(c, http.StatusBadRequest, authapp.ErrExternalLoginInvalid)
+	}
+
+	uow := s.getAuthUoW()
+	res, err := s.authService.CompleteExternalLogin(
+		c.Request().Context(),
+		uow,
+		s.requestDevice(c),
+		req.Provider,
+		req.Code,
+		req.State,
+		stateToken,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, authapp.ErrUnknownProvider):
+			return JsonError(c, http.StatusNotFound, err)
+		case errors.Is(err, authapp.ErrExternalLoginInvalid),
+			errors.Is(err, oidc.ErrExchangeFailed),
+			errors.Is(err, oidc.ErrInvalidIDToken):
+			return JsonError(c, http.StatusUnauthorized, authapp.ErrExternalLoginInvalid)
+		case errors.Is(err, auth.ErrReauthenticationRequired):
+			return JsonError(c, http.StatusUnauthorized, err)
+		case errors.Is(err, authapp.ErrExternalEmailMissing),
+			errors.Is(err, auth.ErrAccountLocked),
+			errors.Is(err, auth.ErrIdentityNotLinked):
+			return JsonError(c, http.StatusForbidden, err)
+		case errors.Is(err, authapp.ErrExternalEmailTaken), errors.Is(err, auth.ErrIdentityLinked):
+			return JsonError(c, http.StatusConflict, err)
+		case errors.Is(err, oidc.ErrProviderUnavailable):
+			return JsonError(c, http.StatusBadGateway, oidc.ErrProviderUnavailable)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	if res.ReauthToken != "" {
+		return c.JSON(http.StatusOK, &ReauthenticationResponse{ReauthToken: res.ReauthToken})
+	}
+
+	if res.MFAToken != "" {
+		return c.JSON(http.StatusOK, &loginResp{
+			MFARequired: true,
+			MFAToken:    res.MFAToken,
+		})
+	}
+
+	tokens := s.deliverTokens(c, res.Tokens)
+	return c.JSON(http.StatusOK, &loginResp{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+func (s *Server) externalStateCookie(c echo.Context, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     externalStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.secureCookies(c),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	onboardingapp "github.com/burenotti/go_health_backend/internal/app/onboarding"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (s *Server) MountOnboarding() {
+	s.handler.POST("/onboarding", s.Onboard)
+}
+
+func (s *Server) getOnboardingUoW() *unitofwork.UnitOfWork[*onboardingapp.AtomicContext] {
+	return unitofwork.New[*onboardingapp.AtomicContext](s.db, onboardingapp.NewAtomicContext, s.msgBus, s.logger)
+}
+
+type OnboardingRequest struct {
+	UserID   string               `json:"user_id" validate:"required,uuid"`
+	Email    string               `json:"email" validate:"required,email"`
+	Password string               `json:"password" validate:"required"`
+	Profile  CreateProfileRequest `json:"profile"`
+}
+
+type OnboardingResponse struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Profile      any    `json:"profile"`
+}
+
+// Onboard signs the user up with a profile and logs them in.
+func (s *Server) Onboard(c echo.Context) error {
+	var req OnboardingRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	res, err := s.onboardingService.SignUp(
+		c.Request().Context(),
+		s.getOnboardingUoW(),
+		s.requestDevice(c),
+		req.UserID,
+		req.Email,
+		req.Password,
+		req.Profile.Type,
+		req.Profile.fields(),
+	)
+	if err != nil {
+		if ok, err := PasswordPolicyError(c, err); ok {
+			return err
+		}
+		if errors.Is(err, auth.ErrUserExists) {
+			return JsonError(c, http.StatusBadRequest, "user already exists")
+		}
+		return createProfileError(c, err)
+	}
+
+	tokens := res.Tokens
+	if tokens.AccessToken != "" {
+		tokens = s.deliverTokens(c, tokens)
+	}
+	return c.JSON(http.StatusCreated, OnboardingResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Profile:      profileResponse(res.Profile),
+	})
+}
@@ -1,11 +1,19 @@
 package api
 
 import (
+	"github.com/burenotti/go_health_backend/internal/adapter/clientip"
+	"github.com/burenotti/go_health_backend/internal/adapter/geoip"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	accountapp "github.com/burenotti/go_health_backend/internal/app/account"
+	adminapp "github.com/burenotti/go_health_backend/internal/app/admin"
+	apikeyapp "github.com/burenotti/go_health_backend/internal/app/apikey"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	exportapp "github.com/burenotti/go_health_backend/internal/app/export"
 	groupservice "github.com/burenotti/go_health_backend/internal/app/group"
 	inviteservice "github.com/burenotti/go_health_backend/internal/app/invite"
 	metricservice "github.com/burenotti/go_health_backend/internal/app/metric"
+	onboardingapp "github.com/burenotti/go_health_backend/internal/app/onboarding"
 	profileapp "github.com/burenotti/go_health_backend/internal/app/profile"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"log/slog"
@@ -62,8 +70,76 @@ func MetricService(service *metricservice.Service) Option {
 	}
 }
 
+func AccountService(service *accountapp.Service) Option {
+	return func(s *Server) {
+		s.accountService = service
+	}
+}
+
+func ExportService(service *exportapp.Service) Option {
+	return func(s *Server) {
+		s.exportService = service
+	}
+}
+
+func APIKeyService(service *apikeyapp.Service) Option {
+	return func(s *Server) {
+		s.apiKeyService = service
+	}
+}
+
+func AuditService(service *auditapp.Service) Option {
+	return func(s *Server) {
+		s.auditService = service
+	}
+}
+
+func AdminService(service *adminapp.Service) Option {
+	return func(s *Server) {
+		s.adminService = service
+	}
+}
+
+func OnboardingService(service *onboardingapp.Service) Option {
+	return func(s *Server) {
+		s.onboardingService = service
+	}
+}
+
 func MessageBus(bus unitofwork.MessageBus) Option {
 	return func(s *Server) {
 		s.msgBus = bus
 	}
 }
+
+func Revocations(list *authapp.RevocationList) Option {
+	return func(s *Server) {
+		s.revocations = list
+	}
+}
+
+func VerifiedEmailRoutes(prefixes []string) Option {
+	return func(s *Server) {
+		s.verifiedEmailRoutes = prefixes
+	}
+}
+
+func TrustedProxies(r *clientip.Resolver) Option {
+	return func(s *Server) {
+		s.handler.IPExtractor = r.ExtractIP
+	}
+}
+
+func GeoDatabase(db *geoip.Database) Option {
+	return func(s *Server) {
+		s.geo = db
+	}
+}
+
+// Cookies enables the cookie session mode. A nil session keeps the header
+// scheme only.
+func Cookies(session *CookieSession) Option {
+	return func(s *Server) {
+		s.cookies = session
+	}
+}
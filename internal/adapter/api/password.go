@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (s *Server) ForgotPassword(c echo.Context) error {
+	var req ForgotPasswordRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getAuthUoW()
+	if err := s.authService.RequestPasswordReset(c.Request().Context(), uow, req.Email); err != nil {
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+func (s *Server) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getAuthUoW()
+	if err := s.authService.ResetPassword(c.Request().Context(), uow, req.Token, req.Password); err != nil {
+		if ok, err := PasswordPolicyError(c, err); ok {
+			return err
+		}
+		if errors.Is(err, auth.ErrPasswordResetInvalid) {
+			return JsonError(c, http.StatusBadRequest, auth.ErrPasswordResetInvalid)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+	LogoutOthers    bool   `json:"logout_others"`
+}
+
+func (s *Server) ChangePassword(c echo.Context) error {
+	var req ChangePasswordRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+	err := s.authService.ChangePassword(
+		c.Request().Context(),
+		uow,
+		user.UserID,
+		user.Authorization,
+		req.CurrentPassword,
+		req.NewPassword,
+		req.LogoutOthers,
+	)
+	if err != nil {
+		if ok, err := PasswordPolicyError(c, err); ok {
+			return err
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return JsonError(c, http.StatusBadRequest, "current password is invalid")
+		}
+		if errors.Is(err, auth.ErrUnauthorized) {
+			return JsonError(c, http.StatusUnauthorized, "unauthorized")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
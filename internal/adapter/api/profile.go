@@ -1,24 +1,27 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/burenotti/go_health_backend/internal/app/authapp"
 	profileservice "github.com/burenotti/go_health_backend/internal/app/profile"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/domain/profile"
 	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
 	"net/http"
 	"time"
 )
 
 func (s *Server) MountProfile() {
-	s.handler.POST("/trainees/:user_id", s.CreateTrainee)
 	s.handler.GET("/trainees/:user_id", s.GetTraineeByID)
-
-	s.handler.POST("/coaches/:user_id", s.CreateCoach)
 	s.handler.GET("/coaches/:user_id", s.GetCoachByID)
 
-	s.handler.GET("/profiles/me", s.GetMyProfile, LoginRequired(s.authService.Authorizer))
+	s.handler.POST("/profiles/me", s.CreateMyProfile, s.LoginRequired())
+	s.handler.GET("/profiles/me", s.GetMyProfile, s.LoginRequired())
+	s.handler.PATCH("/profiles/me", s.UpdateMyProfile, s.LoginRequired())
 }
 
 func (s *Server) getProfileUoW() *unitofwork.UnitOfWork[*profileservice.AtomicContext] {
@@ -30,33 +33,8 @@ func (s *Server) getProfileUoW() *unitofwork.UnitOfWork[*profileservice.AtomicCo
 	)
 }
 
-type CreateTraineeRequest struct {
-	UserID    string     `param:"user_id"`
-	FirstName string     `json:"first_name,omitempty"`
-	LastName  string     `json:"last_name,omitempty"`
-	BirthDate *time.Time `json:"birth_date,omitempty"`
-}
-
-func (s *Server) CreateTrainee(c echo.Context) error {
-	var req CreateTraineeRequest
-	if err := s.bind(c, &req); err != nil {
-		return JsonError(c, http.StatusBadRequest, err)
-	}
-
-	uow := s.getProfileUoW()
-	ctx := c.Request().Context()
-	_, err := s.profileService.CreateTrainee(ctx, req.UserID, req.FirstName, req.LastName, req.BirthDate, uow)
-	if err != nil {
-		if errors.Is(err, profile.ErrProfileExists) {
-			return JsonError(c, http.StatusNotFound, "profile already exists")
-		}
-		return JsonError(c, http.StatusInternalServerError, err)
-	}
-	return c.NoContent(http.StatusNoContent)
-}
-
-type CreateCoachRequest struct {
-	UserID          string     `param:"user_id"`
+type CreateProfileRequest struct {
+	Type            string     `json:"type" validate:"required,oneof=trainee coach"`
 	FirstName       string     `json:"first_name,omitempty"`
 	LastName        string     `json:"last_name,omitempty"`
 	BirthDate       *time.Time `json:"birth_date,omitempty"`
@@ -64,33 +42,47 @@ type CreateCoachRequest struct {
 	Bio             string     `json:"bio,omitempty"`
 }
 
-func (s *Server) CreateCoach(c echo.Context) error {
-	var req CreateCoachRequest
+// fields leaves out the coach fields if they are empty, so a trainee profile
+// can be created from the same request.
+func (r *CreateProfileRequest) fields() profile.Patch {
+	fields := profile.Patch{
+		FirstName: profile.Set(r.FirstName),
+		LastName:  profile.Set(r.LastName),
+		BirthDate: profile.Set(r.BirthDate),
+	}
+	if r.YearsExperience != 0 {
+		fields.YearsExperience = profile.Set(r.YearsExperience)
+	}
+	if r.Bio != "" {
+		fields.Bio = profile.Set(r.Bio)
+	}
+	return fields
+}
+
+// CreateMyProfile creates the profile of the current user.
+func (s *Server) CreateMyProfile(c echo.Context) error {
+	var req CreateProfileRequest
 	if err := s.bind(c, &req); err != nil {
 		return JsonError(c, http.StatusBadRequest, err)
 	}
 
-	uow := s.getProfileUoW()
-	ctx := c.Request().Context()
-
-	_, err := s.profileService.CreateCoach(
-		ctx,
-		req.UserID,
-		req.FirstName,
-		req.LastName,
-		req.BirthDate,
-		req.YearsExperience,
-		req.Bio,
-		uow,
-	)
-
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	p, err := s.profileService.CreateProfile(c.Request().Context(), user.UserID, req.Type, req.fields(), s.getProfileUoW())
 	if err != nil {
-		if errors.Is(err, profile.ErrProfileExists) {
-			return JsonError(c, http.StatusNotFound, "profile already exists")
-		}
-		return JsonError(c, http.StatusInternalServerError, err)
+		return createProfileError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, profileResponse(p))
+}
+
+func createProfileError(c echo.Context, err error) error {
+	if errors.Is(err, profile.ErrProfileExists) {
+		return JsonError(c, http.StatusConflict, "profile already exists")
 	}
-	return c.NoContent(http.StatusNoContent)
+	if errors.Is(err, profile.ErrInvalidPatch) {
+		return JsonError(c, http.StatusUnprocessableEntity, err)
+	}
+	return JsonError(c, http.StatusInternalServerError, err)
 }
 
 type GetCoachByIDRequest struct {
@@ -184,9 +176,13 @@ func (s *Server) GetMyProfile(c echo.Context) error {
 		return JsonError(c, http.StatusInternalServerError, err)
 	}
 
+	return c.JSON(http.StatusOK, profileResponse(p))
+}
+
+func profileResponse(p profile.Profile) any {
 	switch v := p.(type) {
 	case *profile.Coach:
-		return c.JSON(http.StatusOK, GetCoachByIDResponse{
+		return GetCoachByIDResponse{
 			UserID:          v.UserID,
 			Type:            v.Type(),
 			FirstName:       v.FirstName,
@@ -194,16 +190,90 @@ func (s *Server) GetMyProfile(c echo.Context) error {
 			BirthDate:       v.BirthDate,
 			YearsExperience: v.YearsExperience,
 			Bio:             v.Bio,
-		})
+		}
 	case *profile.Trainee:
-		return c.JSON(http.StatusOK, GetTraineeByIDResponse{
+		return GetTraineeByIDResponse{
 			UserID:    v.UserID,
 			Type:      v.Type(),
 			FirstName: v.FirstName,
 			LastName:  v.LastName,
 			BirthDate: v.BirthDate,
-		})
+		}
 	default:
 		panic("unknown profile type")
 	}
 }
+
+const mimeMergePatch = "application/merge-patch+json"
+
+// UpdateMyProfile applies a JSON Merge Patch (RFC 7396) to the profile of the
+// current user. Members set to null are cleared.
+func (s *Server) UpdateMyProfile(c echo.Context) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != mimeMergePatch && mediaType != echo.MIMEApplicationJSON {
+		return JsonError(c, http.StatusUnsupportedMediaType, "expected "+mimeMergePatch)
+	}
+
+	patch, err := decodeProfilePatch(c.Request().Body)
+	if err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	p, err := s.profileService.UpdateProfile(c.Request().Context(), user.UserID, patch, s.getProfileUoW())
+	if err != nil {
+		if errors.Is(err, profile.ErrProfileNotFound) {
+			return JsonError(c, http.StatusNotFound, "profile not found")
+		}
+		if errors.Is(err, profile.ErrInvalidPatch) {
+			return JsonError(c, http.StatusUnprocessableEntity, err)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, profileResponse(p))
+}
+
+func decodeProfilePatch(body io.Reader) (profile.Patch, error) {
+	var (
+		members map[string]json.RawMessage
+		patch   profile.Patch
+	)
+	if err := json.NewDecoder(body).Decode(&members); err != nil || members == nil {
+		return patch, errors.New("patch must be a json object")
+	}
+
+	for name, raw := range members {
+		var err error
+		switch name {
+		case "first_name":
+			patch.FirstName, err = decodeField[string](raw)
+		case "last_name":
+			patch.LastName, err = decodeField[string](raw)
+		case "birth_date":
+			patch.BirthDate, err = decodeField[*time.Time](raw)
+		case "years_experience":
+			patch.YearsExperience, err = decodeField[int](raw)
+		case "bio":
+			patch.Bio, err = decodeField[string](raw)
+		default:
+			return patch, fmt.Errorf("unknown field %q", name)
+		}
+		if err != nil {
+			return patch, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return patch, nil
+}
+
+// decodeField sets the field to the zero value if the member is null.
+func decodeField[T any](raw json.RawMessage) (profile.Field[T], error) {
+	var v T
+	if string(raw) == "null" {
+		return profile.Set(v), nil
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return profile.Field[T]{}, err
+	}
+	return profile.Set(v), nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"net/http"
+	"time"
+)
+
+type Session struct {
+	SessionID   string    `json:"session_id"`
+	Browser     string    `json:"browser"`
+	OS          string    `json:"os"`
+	IPAddress   string    `json:"ip_address"`
+	Country     string    `json:"country,omitempty"`
+	Network     string    `json:"network,omitempty"`
+	Model       string    `json:"model"`
+	StartedAt   time.Time `json:"started_at"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	ValidUntil  time.Time `json:"valid_until"`
+	Current     bool      `json:"current"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+func (s *Server) ListSessions(c echo.Context) error {
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+
+	sessions, err := s.authService.ListSessions(c.Request().Context(), uow, user.UserID, user.Authorization)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return JsonError(c, http.StatusUnauthorized, "unauthorized")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, ListSessionsResponse{
+		Sessions: lo.Map(sessions, func(item authapp.Session, _ int) Session {
+			return Session{
+				SessionID:   item.ID,
+				Browser:     item.Device.Browser,
+				OS:          item.Device.OS,
+				IPAddress:   item.Device.IPAddress,
+				Country:     item.Device.Country,
+				Network:     item.Device.ASOrg,
+				Model:       item.Device.Model,
+				StartedAt:   item.StartedAt,
+				RefreshedAt: item.RefreshedAt,
+				ValidUntil:  item.ValidUntil,
+				Current:     item.Current,
+			}
+		}),
+	})
+}
+
+type RevokeSessionRequest struct {
+	SessionID string `param:"session_id" validate:"required,uuid"`
+}
+
+func (s *Server) RevokeSession(c echo.Context) error {
+	var req RevokeSessionRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+
+	if err := s.authService.RevokeSession(c.Request().Context(), uow, user.UserID, req.SessionID); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			return JsonError(c, http.StatusNotFound, "session not found")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) RevokeOtherSessions(c echo.Context) error {
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+
+	if err := s.authService.RevokeOtherSessions(c.Request().Context(), uow, user.UserID, user.Authorization); err != nil {
+		if errors.Is(err, auth.ErrUnauthorized) {
+			return JsonError(c, http.StatusUnauthorized, "unauthorized")
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
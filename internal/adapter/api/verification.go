@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (s *Server) VerifyEmail(c echo.Context) error {
+	var req VerifyEmailRequest
+	if err := s.bind(c, &req); err != nil {
+		return JsonError(c, http.StatusBadRequest, err)
+	}
+
+	uow := s.getAuthUoW()
+	if err := s.authService.VerifyEmail(c.Request().Context(), uow, req.Token); err != nil {
+		if errors.Is(err, auth.ErrVerificationInvalid) {
+			return JsonError(c, http.StatusBadRequest, auth.ErrVerificationInvalid)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) ResendEmailVerification(c echo.Context) error {
+	user := c.Get(KeyCurrentUser).(*authapp.AccessTokenData)
+	uow := s.getAuthUoW()
+
+	if err := s.authService.ResendEmailVerification(c.Request().Context(), uow, user.UserID); err != nil {
+		if errors.Is(err, auth.ErrEmailVerified) {
+			return JsonError(c, http.StatusConflict, auth.ErrEmailVerified)
+		}
+		return JsonError(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,146 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver extracts the client address of a request that may have passed
+// through reverse proxies. Forwarding headers are only trusted as far as the
+// chain of hops consists of trusted proxies: the chain is walked from the
+// connection peer backwards and the first address outside of the trusted
+// networks is the client.
+//
+// The RFC 7239 Forwarded header takes precedence over X-Forwarded-For.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver parses the trusted proxy networks. Single addresses are
+// accepted as well as CIDRs.
+func NewResolver(cidrs []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		if !strings.Contains(c, "/") {
+			addr, err := netip.ParseAddr(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+			}
+			addr = addr.Unmap()
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		r.trusted = append(r.trusted, p.Masked())
+	}
+	return r, nil
+}
+
+// ExtractIP has the signature of echo.IPExtractor. It returns an empty
+// string if the address can't be determined.
+func (r *Resolver) ExtractIP(req *http.Request) string {
+	addr, ok := r.Resolve(req)
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
+
+func (r *Resolver) Resolve(req *http.Request) (netip.Addr, bool) {
+	peer, ok := parseHost(req.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	if !r.isTrusted(peer) {
+		return peer, true
+	}
+
+	var hops []string
+	if values := req.Header.Values("Forwarded"); len(values) != 0 {
+		hops = forwardedFor(values)
+	} else {
+		hops = splitList(req.Header.Values("X-Forwarded-For"))
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHost(hops[i])
+		if !ok {
+			// Obfuscated identifiers and garbage end the chain: nothing
+			// before them can be attributed to a trusted hop.
+			break
+		}
+		client = addr
+		if !r.isTrusted(addr) {
+			break
+		}
+	}
+	return client, true
+}
+
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= parameters of Forwarded header elements in
+// the order the proxies appended them.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "for") {
+				continue
+			}
+			hops = append(hops, strings.Trim(strings.TrimSpace(value), `"`))
+		}
+	}
+	return hops
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseHost accepts a bare address, an address with a port and a bracketed
+// IPv6 address with or without a port.
+func parseHost(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
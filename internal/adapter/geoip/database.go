@@ -0,0 +1,131 @@
+package geoip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidDatabase = errors.New("invalid geoip database file")
+)
+
+// Network is the coarse location of an address: the country it is
+// registered in and the autonomous system announcing it.
+type Network struct {
+	Country string
+	ASN     uint32
+	ASOrg   string
+}
+
+type addrRange struct {
+	start   netip.Addr
+	end     netip.Addr
+	network Network
+}
+
+// Database resolves addresses against a local copy of an IP to ASN
+// database, so no request leaves the server.
+//
+// The file is the tab separated format of the ip2asn-combined dataset: range
+// start, range end, AS number, country code and AS description per line,
+// ranges sorted and non-overlapping. Unrouted ranges have AS number 0.
+type Database struct {
+	ranges []addrRange
+}
+
+func Load(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := &Database{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		r, err := parseRange(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidDatabase, line, err)
+		}
+		if r.network.ASN != 0 {
+			db.ranges = append(db.ranges, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDatabase, err)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	return db, nil
+}
+
+func parseRange(line string) (addrRange, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 5 {
+		return addrRange{}, errors.New("expected 5 fields")
+	}
+
+	start, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		return addrRange{}, err
+	}
+	end, err := netip.ParseAddr(fields[1])
+	if err != nil {
+		return addrRange{}, err
+	}
+	start, end = start.Unmap(), end.Unmap()
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return addrRange{}, errors.New("invalid range")
+	}
+
+	asn, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return addrRange{}, err
+	}
+
+	country := fields[3]
+	if len(country) != 2 {
+		country = ""
+	}
+
+	return addrRange{
+		start: start,
+		end:   end,
+		network: Network{
+			Country: strings.ToUpper(country),
+			ASN:     uint32(asn),
+			ASOrg:   fields[4],
+		},
+	}, nil
+}
+
+// Lookup returns the network the address belongs to, or false if it isn't
+// routed on the public internet.
+func (db *Database) Lookup(addr netip.Addr) (Network, bool) {
+	addr = addr.Unmap()
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	})
+	if i == 0 {
+		return Network{}, false
+	}
+
+	r := db.ranges[i-1]
+	if r.end.Less(addr) {
+		return Network{}, false
+	}
+	return r.network, true
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// LogMailer is meant for development. It appends messages to a file or,
+// when no path is set, writes them to the log.
+type LogMailer struct {
+	Path   string
+	From   string
+	Logger *slog.Logger
+	mu     sync.Mutex
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	if m.Path == "" {
+		m.Logger.Info("mail sent", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(msg.render(m.From), "\r\n\r\n"...)); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+	return nil
+}
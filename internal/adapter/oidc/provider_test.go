@@ -0,0 +1,295 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID    = "client"
+	testRedirectURL = "https://app.example/auth/oidc/test/callback"
+	testKeyID       = "key-1"
+)
+
+// mockIdP is an OpenID Connect provider serving discovery, keys and the
+// token endpoint. It issues a single authorization code bound to the PKCE
+// challenge and nonce of the last authorization request.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// issuer is advertised in the discovery document.
+	issuer string
+	// claims override the claims of the issued ID token.
+	claims jwt.MapClaims
+
+	code      string
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{t: t, key: key, code: "code-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, idp.server.Client())
+}
+
+// authorize follows the redirect the way the provider would after the user
+// signed in.
+func (idp *mockIdP) authorize(redirectURL string) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("code_challenge_method = %q", q.Get("code_challenge_method"))
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 idp.issuer,
+		"authorization_endpoint": idp.server.URL + "/authorize",
+		"token_endpoint":         idp.server.URL + "/token",
+		"jwks_uri":               idp.server.URL + "/keys",
+	})
+}
+
+func (idp *mockIdP) keys(w http.ResponseWriter, _ *http.Request) {
+	pub := idp.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		idp.t.Fatal(err)
+	}
+	if r.PostForm.Get("code") != idp.code || r.PostForm.Get("redirect_uri") != testRedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if CodeChallenge(r.PostForm.Get("code_verifier")) != idp.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_grant",
+			"error_description": "code verifier does not match",
+		})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          idp.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"auth_time":      now.Unix(),
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": signed})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	for _, reauth := range []bool{false, true} {
+		redirectURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1", reauth)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := url.Parse(redirectURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+
+		want := map[string]string{
+			"response_type":         "code",
+			"client_id":             testClientID,
+			"redirect_uri":          testRedirectURL,
+			"state":                 "state-1",
+			"nonce":                 "nonce-1",
+			"code_challenge":        CodeChallenge("verifier-1"),
+			"code_challenge_method": "S256",
+		}
+		if reauth {
+			want["prompt"] = "login"
+			want["max_age"] = "0"
+		}
+		for k, v := range want {
+			if got := q.Get(k); got != v {
+				t.Errorf("reauth=%v: %s = %q, want %q", reauth, k, got, v)
+			}
+		}
+		if !reauth && (q.Has("prompt") || q.Has("max_age")) {
+			t.Errorf("login must not force reauthentication: %s", redirectURL)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		issuer   string
+		claims   jwt.MapClaims
+		wantErr  error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:     "pkce verifier mismatch",
+			verifier: "another-verifier",
+			wantErr:  ErrExchangeFailed,
+		},
+		{
+			name:    "nonce mismatch",
+			nonce:   "another-nonce",
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "nonce missing",
+			claims:  jwt.MapClaims{"nonce": ""},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "issuer mismatch",
+			claims:  jwt.MapClaims{"iss": "https://evil.example"},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "audience mismatch",
+			claims:  jwt.MapClaims{"aud": "another-client"},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "authorized party mismatch",
+			claims:  jwt.MapClaims{"aud": []string{testClientID, "another-client"}, "azp": "another-client"},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "expired",
+			claims:  jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "discovery issuer mismatch",
+			issuer:  "https://evil.example",
+			wantErr: ErrProviderUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = tt.claims
+			if tt.issuer != "" {
+				idp.issuer = tt.issuer
+			}
+			p := idp.provider()
+			ctx := context.Background()
+
+			redirectURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1", false)
+			if tt.wantErr == ErrProviderUnavailable {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("AuthCodeURL() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			idp.authorize(redirectURL)
+
+			verifier, nonce := "verifier-1", "nonce-1"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			claims, err := p.Exchange(ctx, idp.code, verifier, nonce)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.Subject != "subject-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+			if time.Since(claims.AuthTime) > time.Minute {
+				t.Errorf("auth time = %v", claims.AuthTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package apikeystorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/apikey"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+	"strings"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, k *apikey.APIKey) error {
+	q := sqlf.InsertInto("api_keys").
+		Set("key_id", k.KeyID).
+		Set("user_id", k.UserID).
+		Set("name", k.Name).
+		Set("prefix", k.Prefix).
+		Set("secret_hash", k.SecretHash).
+		Set("scopes", strings.Join(k.Scopes, " ")).
+		Set("created_at", k.CreatedAt).
+		Set("last_used_at", k.LastUsedAt).
+		Set("revoked_at", k.RevokedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+
+	s.base.MarkSeen(k)
+	return nil
+}
+
+func (s *PostgresStorage) get(ctx context.Context, where string, args ...any) ([]*apikey.APIKey, error) {
+	var (
+		tmp    apikey.APIKey
+		scopes string
+		keys   []*apikey.APIKey
+	)
+
+	q := sqlf.From("api_keys").
+		Select("key_id").To(&tmp.KeyID).
+		Select("user_id").To(&tmp.UserID).
+		Select("name").To(&tmp.Name).
+		Select("prefix").To(&tmp.Prefix).
+		Select("secret_hash").To(&tmp.SecretHash).
+		Select("scopes").To(&scopes).
+		Select("created_at").To(&tmp.CreatedAt).
+		Select("last_used_at").To(&tmp.LastUsedAt).
+		Select("revoked_at").To(&tmp.RevokedAt).
+		Where(where, args...).
+		OrderBy("created_at")
+
+	err := q.QueryAndClose(ctx, s.base.DB, func(rows *sql.Rows) {
+		keys = append(keys, &apikey.APIKey{
+			KeyID:      tmp.KeyID,
+			UserID:     tmp.UserID,
+			Name:       tmp.Name,
+			Prefix:     tmp.Prefix,
+			SecretHash: tmp.SecretHash,
+			Scopes:     strings.Fields(scopes),
+			CreatedAt:  tmp.CreatedAt,
+			LastUsedAt: tmp.LastUsedAt,
+			RevokedAt:  tmp.RevokedAt,
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.InternalError(err)
+	}
+	return keys, nil
+}
+
+func (s *PostgresStorage) GetByID(ctx context.Context, keyID string) (*apikey.APIKey, error) {
+	keys, err := s.get(ctx, "key_id = ?", keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, apikey.ErrKeyNotFound
+	}
+	return keys[0], nil
+}
+
+func (s *PostgresStorage) GetBySecretHash(ctx context.Context, secretHash string) (*apikey.APIKey, error) {
+	keys, err := s.get(ctx, "secret_hash = ?", secretHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, apikey.ErrKeyNotFound
+	}
+	return keys[0], nil
+}
+
+func (s *PostgresStorage) ListActiveByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error) {
+	return s.get(ctx, "user_id = ? AND revoked_at IS NULL", userID)
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, k *apikey.APIKey) error {
+	dbState, err := s.GetByID(ctx, k.KeyID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, k)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("api_keys").Where("key_id = ?", k.KeyID)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, apikey.ErrKeyNotFound); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(k)
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
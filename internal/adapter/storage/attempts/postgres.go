@@ -0,0 +1,108 @@
+package attemptstorage
+
+import (
+	"context"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+	"time"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+// Get returns the attempts of the subject and locks them until the end of
+// the transaction, so concurrent logins can't lose failures.
+func (s *PostgresStorage) Get(ctx context.Context, scope, subject string) (*auth.LoginAttempts, error) {
+	insert := sqlf.InsertInto("login_attempts").
+		Set("scope", scope).
+		Set("subject", subject).
+		Clause("ON CONFLICT DO NOTHING")
+
+	if _, err := insert.ExecAndClose(ctx, s.base.DB); err != nil {
+		return nil, storage.InternalError(err)
+	}
+
+	l := auth.NewLoginAttempts(scope, subject)
+	q := sqlf.From("login_attempts").
+		Select("failures").To(&l.Failures).
+		Select("last_failure_at").To(&l.LastFailureAt).
+		Select("blocked_until").To(&l.BlockedUntil).
+		Where("scope = ?", scope).
+		Where("subject = ?", subject).
+		Clause("FOR UPDATE")
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		return nil, storage.InternalError(err)
+	}
+
+	return l, nil
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, l *auth.LoginAttempts) error {
+	dbState, err := s.Get(ctx, l.Scope, l.Subject)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, l)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("login_attempts").
+			Where("scope = ?", l.Scope).
+			Where("subject = ?", l.Subject)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+			return storage.InternalError(err)
+		}
+	}
+
+	s.base.MarkSeen(l)
+	return nil
+}
+
+// DeleteExpired removes the subjects that aren't blocked and haven't failed
+// since before. Rows locked by running logins are skipped.
+func (s *PostgresStorage) DeleteExpired(ctx context.Context, now, before time.Time) (int64, error) {
+	q := sqlf.DeleteFrom("login_attempts").
+		Where(`(scope, subject) IN (
+			SELECT scope, subject FROM login_attempts
+			WHERE (blocked_until IS NULL OR blocked_until < ?)
+			  AND (last_failure_at IS NULL OR last_failure_at < ?)
+			FOR UPDATE SKIP LOCKED
+		)`, now, before)
+
+	res, err := q.ExecAndClose(ctx, s.base.DB)
+	if err != nil {
+		return 0, storage.InternalError(err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, storage.InternalError(err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
@@ -0,0 +1,139 @@
+package auditstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/leporo/sqlf"
+	"github.com/samber/lo"
+	"time"
+)
+
+// PostgresStorage appends entries to the audit log. Entries are never
+// removed; the only change allowed is erasing the personal data of purged
+// accounts.
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, e *audit.Entry) error {
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return storage.InternalError(err)
+	}
+
+	var actorID *string
+	if e.ActorID != "" {
+		actorID = &e.ActorID
+	}
+
+	q := sqlf.InsertInto("audit_log").
+		Set("user_id", e.UserID).
+		Set("actor_id", actorID).
+		Set("action", e.Action).
+		Set("ip_address", lo.EmptyableToPtr(e.IPAddress)).
+		Set("browser", e.Browser).
+		Set("os", e.OS).
+		Set("device_model", e.DeviceModel).
+		Set("details", string(details)).
+		Set("created_at", e.CreatedAt).
+		Returning("entry_id").To(&e.EntryID)
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+	return nil
+}
+
+// List returns the entries matching the filter, newest first.
+func (s *PostgresStorage) List(ctx context.Context, f audit.Filter) ([]*audit.Entry, error) {
+	var (
+		tmp     audit.Entry
+		actorID *string
+		details []byte
+		entries []*audit.Entry
+	)
+
+	q := sqlf.From("audit_log").
+		Select("entry_id").To(&tmp.EntryID).
+		Select("user_id").To(&tmp.UserID).
+		Select("actor_id").To(&actorID).
+		Select("action").To(&tmp.Action).
+		Select("coalesce(host(ip_address), '')").To(&tmp.IPAddress).
+		Select("browser").To(&tmp.Browser).
+		Select("os").To(&tmp.OS).
+		Select("device_model").To(&tmp.DeviceModel).
+		Select("details").To(&details).
+		Select("created_at").To(&tmp.CreatedAt).
+		OrderBy("created_at DESC", "entry_id DESC")
+
+	if f.UserID != "" {
+		q = q.Where("user_id = ?", f.UserID)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	if f.Offset > 0 {
+		q = q.Offset(f.Offset)
+	}
+
+	var decodeErr error
+	err := q.QueryAndClose(ctx, s.base.DB, func(rows *sql.Rows) {
+		e := tmp
+		if actorID != nil {
+			e.ActorID = *actorID
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			decodeErr = err
+		}
+		entries = append(entries, &e)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.InternalError(err)
+	}
+	if decodeErr != nil {
+		return nil, storage.InternalError(decodeErr)
+	}
+	return entries, nil
+}
+
+// AnonymizeDeleted erases the device data and email addresses from the
+// entries of the users deleted before the given moment. It must run before
+// the users are purged.
+func (s *PostgresStorage) AnonymizeDeleted(ctx context.Context, before time.Time) error {
+	q := sqlf.Update("audit_log").
+		SetExpr("ip_address", "NULL").
+		Set("browser", "").
+		Set("os", "").
+		Set("device_model", "").
+		SetExpr("details", "details - 'old_email' - 'new_email'").
+		Where("user_id IN (SELECT user_id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?)", before)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
@@ -0,0 +1,104 @@
+package emailchangestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, c *auth.EmailChange) error {
+	q := sqlf.InsertInto("email_changes").
+		Set("change_id", c.ChangeID).
+		Set("user_id", c.UserID).
+		Set("old_email", c.OldEmail).
+		Set("new_email", c.NewEmail).
+		Set("authorization_id", c.AuthorizationID).
+		Set("created_at", c.CreatedAt).
+		Set("expires_at", c.ExpiresAt).
+		Set("undo_until", c.UndoUntil).
+		Set("confirmed_at", c.ConfirmedAt).
+		Set("reverted_at", c.RevertedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+
+	s.base.MarkSeen(c)
+	return nil
+}
+
+// GetByID returns the change and locks it until the end of the transaction.
+func (s *PostgresStorage) GetByID(ctx context.Context, changeID string) (*auth.EmailChange, error) {
+	c := &auth.EmailChange{}
+	q := sqlf.From("email_changes").
+		Select("change_id").To(&c.ChangeID).
+		Select("user_id").To(&c.UserID).
+		Select("old_email").To(&c.OldEmail).
+		Select("new_email").To(&c.NewEmail).
+		Select("authorization_id").To(&c.AuthorizationID).
+		Select("created_at").To(&c.CreatedAt).
+		Select("expires_at").To(&c.ExpiresAt).
+		Select("undo_until").To(&c.UndoUntil).
+		Select("confirmed_at").To(&c.ConfirmedAt).
+		Select("reverted_at").To(&c.RevertedAt).
+		Where("change_id = ?", changeID).
+		Clause("FOR UPDATE")
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, auth.ErrEmailChangeInvalid
+		}
+		return nil, storage.InternalError(err)
+	}
+	return c, nil
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, c *auth.EmailChange) error {
+	dbState, err := s.GetByID(ctx, c.ChangeID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, c)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("email_changes").Where("change_id = ?", c.ChangeID)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, auth.ErrEmailChangeInvalid); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(c)
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
@@ -0,0 +1,113 @@
+package exportstorage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/export"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+	"time"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, e *export.Export) error {
+	q := sqlf.InsertInto("data_exports").
+		Set("export_id", e.ExportID).
+		Set("user_id", e.UserID).
+		Set("status", e.Status).
+		Set("created_at", e.CreatedAt).
+		Set("completed_at", e.CompletedAt).
+		Set("expires_at", e.ExpiresAt).
+		Set("archive", e.Archive)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+
+	s.base.MarkSeen(e)
+	return nil
+}
+
+func (s *PostgresStorage) GetByID(ctx context.Context, exportID string) (*export.Export, error) {
+	e := &export.Export{ExportID: exportID}
+
+	q := sqlf.From("data_exports").
+		Select("user_id").To(&e.UserID).
+		Select("status").To(&e.Status).
+		Select("created_at").To(&e.CreatedAt).
+		Select("completed_at").To(&e.CompletedAt).
+		Select("expires_at").To(&e.ExpiresAt).
+		Select("archive").To(&e.Archive).
+		Where("export_id = ?", exportID)
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, export.ErrExportNotFound
+		}
+		return nil, storage.InternalError(err)
+	}
+
+	return e, nil
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, e *export.Export) error {
+	dbState, err := s.GetByID(ctx, e.ExportID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, e)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	archiveChanged := !bytes.Equal(dbState.Archive, e.Archive)
+	if len(log) != 0 || archiveChanged {
+		q := sqlf.Update("data_exports").Where("export_id = ?", e.ExportID)
+		q = pgutil.MakeUpdateQuery(q, log)
+		if archiveChanged {
+			q = q.Set("archive", e.Archive)
+		}
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, export.ErrExportNotFound); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(e)
+	return nil
+}
+
+// DeleteExpired removes the archives that can no longer be downloaded.
+func (s *PostgresStorage) DeleteExpired(ctx context.Context, now time.Time) error {
+	q := sqlf.DeleteFrom("data_exports").Where("expires_at < ?", now)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/burenotti/go_health_backend/internal/domain"
 	"github.com/burenotti/go_health_backend/internal/domain/group"
 	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
 	"log/slog"
 )
 
@@ -48,14 +49,16 @@ func (s *PostgresStorage) get(
 	modify func(stmt *sqlf.Stmt) *sqlf.Stmt,
 ) (map[group.GroupID]*group.Group, error) {
 	tmp := &group.Group{}
+	var coachID *string
 
 	q := sqlf.From("groups g").
 		Select("g.group_id").To(&tmp.GroupID).
 		Select("g.name").To(&tmp.Name).
 		Select("g.description").To(&tmp.Description).
-		Select("g.coach_id").To(&tmp.CoachID).
+		Select("g.coach_id").To(&coachID).
 		Select("g.created_at").To(&tmp.CreatedAt).
-		Select("g.updated_at").To(&tmp.UpdatedAt)
+		Select("g.updated_at").To(&tmp.UpdatedAt).
+		Select("g.archived_at").To(&tmp.ArchivedAt)
 
 	q = modify(q)
 
@@ -63,14 +66,18 @@ func (s *PostgresStorage) get(
 
 	err := q.Query(ctx, s.base.DB, func(rows *sql.Rows) {
 
-		groups[tmp.GroupID] = &group.Group{
+		g := &group.Group{
 			GroupID:     tmp.GroupID,
 			Name:        tmp.Name,
 			Description: tmp.Description,
-			CoachID:     tmp.CoachID,
 			CreatedAt:   tmp.CreatedAt,
 			UpdatedAt:   tmp.UpdatedAt,
+			ArchivedAt:  tmp.ArchivedAt,
 		}
+		if coachID != nil {
+			g.CoachID = group.CoachID(*coachID)
+		}
+		groups[tmp.GroupID] = g
 	})
 
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
@@ -87,7 +94,7 @@ func (s *PostgresStorage) ListByCoach(
 	offset int,
 ) (map[group.GroupID]*group.Group, error) {
 	return s.get(ctx, func(stmt *sqlf.Stmt) *sqlf.Stmt {
-		return stmt.Where("g.coach_id = ?", coachID).Offset(offset).Limit(limit)
+		return paginate(stmt.Where("g.coach_id = ?", coachID), limit, offset)
 	})
 }
 
@@ -98,11 +105,10 @@ func (s *PostgresStorage) ListByTrainee(
 	offset int,
 ) (map[group.GroupID]*group.Group, error) {
 	return s.get(ctx, func(stmt *sqlf.Stmt) *sqlf.Stmt {
-		return stmt.LeftJoin("invites i", "g.group_id = i.group_id").
+		stmt = stmt.LeftJoin("invites i", "g.group_id = i.group_id").
 			LeftJoin("invites_accept ia", "i.invite_id = ia.invite_id").
-			Where("ia.trainee_id = ?", traineeID).
-			Offset(offset).
-			Limit(limit)
+			Where("ia.trainee_id = ?", traineeID)
+		return paginate(stmt, limit, offset)
 	})
 }
 
@@ -159,6 +165,77 @@ func (s *PostgresStorage) GetMembers(
 	return
 }
 
+func (s *PostgresStorage) Persist(ctx context.Context, g *group.Group) error {
+	dbState, err := s.GetByID(ctx, g.GroupID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, g)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("groups").Where("group_id = ?", g.GroupID)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, group.ErrGroupNotFound); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(g)
+	return nil
+}
+
+// RemoveTrainee removes the trainee from every group it has joined.
+func (s *PostgresStorage) RemoveTrainee(ctx context.Context, traineeID group.TraineeID) error {
+	q := sqlf.DeleteFrom("invites_accept").Where("trainee_id = ?", traineeID)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) IsGroupMember(
+	ctx context.Context,
+	groupID group.GroupID,
+	traineeID group.TraineeID,
+) (ok bool, err error) {
+	q := sqlf.From("invites i").
+		Join("invites_accept ia", "i.invite_id = ia.invite_id").
+		Where("i.group_id = ?", groupID).
+		Where("ia.trainee_id = ?", traineeID).
+		Select("count(*) > 0").To(&ok)
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		return false, storage.InternalError(err)
+	}
+	return ok, nil
+}
+
+// IsCoachOf reports whether the trainee is a member of any group of the coach.
+func (s *PostgresStorage) IsCoachOf(
+	ctx context.Context,
+	coachID group.CoachID,
+	traineeID group.TraineeID,
+) (ok bool, err error) {
+	q := sqlf.From("groups g").
+		Join("invites i", "i.group_id = g.group_id").
+		Join("invites_accept ia", "i.invite_id = ia.invite_id").
+		Where("g.coach_id = ?", coachID).
+		Where("ia.trainee_id = ?", traineeID).
+		Select("count(*) > 0").To(&ok)
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		return false, storage.InternalError(err)
+	}
+	return ok, nil
+}
+
 func (s *PostgresStorage) Close() error {
 	s.base.Close()
 	return nil
@@ -167,3 +244,14 @@ func (s *PostgresStorage) Close() error {
 func (s *PostgresStorage) CollectEvents() []domain.Event {
 	return s.base.CollectEvents()
 }
+
+// paginate applies limit and offset; a non-positive limit means no limit.
+func paginate(stmt *sqlf.Stmt, limit, offset int) *sqlf.Stmt {
+	if limit > 0 {
+		stmt = stmt.Limit(limit)
+	}
+	if offset > 0 {
+		stmt = stmt.Offset(offset)
+	}
+	return stmt
+}
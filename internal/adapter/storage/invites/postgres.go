@@ -175,6 +175,17 @@ func (s *PostgresStorage) ListByGroupID(
 	})
 }
 
+// ListAcceptedByTrainee returns the invites accepted by the trainee. Only
+// the accept of that trainee is loaded.
+func (s *PostgresStorage) ListAcceptedByTrainee(
+	ctx context.Context,
+	traineeID invite.TraineeID,
+) (map[invite.InviteID]*invite.Invite, error) {
+	return s.get(ctx, func(stmt *sqlf.Stmt) *sqlf.Stmt {
+		return stmt.Where("a.trainee_id = ?", traineeID)
+	})
+}
+
 func (s *PostgresStorage) AddAccept(
 	ctx context.Context,
 	accept invite.Accept,
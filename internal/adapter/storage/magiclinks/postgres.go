@@ -0,0 +1,106 @@
+package magiclinkstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+	"github.com/samber/lo"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, l *auth.MagicLink) error {
+	q := sqlf.InsertInto("magic_links").
+		Set("link_id", l.LinkID).
+		Set("user_id", l.UserID).
+		Set("nonce_hash", l.NonceHash).
+		Set("browser", l.Device.Browser).
+		Set("os", l.Device.OS).
+		Set("device_model", l.Device.Model).
+		Set("ip_address", lo.EmptyableToPtr(l.Device.IPAddress)).
+		Set("created_at", l.CreatedAt).
+		Set("expires_at", l.ExpiresAt).
+		Set("used_at", l.UsedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+
+	s.base.MarkSeen(l)
+	return nil
+}
+
+// GetByID returns the link and locks it until the end of the transaction, so
+// it can't be used twice concurrently.
+func (s *PostgresStorage) GetByID(ctx context.Context, linkID string) (*auth.MagicLink, error) {
+	l := &auth.MagicLink{}
+	q := sqlf.From("magic_links").
+		Select("link_id").To(&l.LinkID).
+		Select("user_id").To(&l.UserID).
+		Select("nonce_hash").To(&l.NonceHash).
+		Select("browser").To(&l.Device.Browser).
+		Select("os").To(&l.Device.OS).
+		Select("device_model").To(&l.Device.Model).
+		Select("coalesce(host(ip_address), '')").To(&l.Device.IPAddress).
+		Select("created_at").To(&l.CreatedAt).
+		Select("expires_at").To(&l.ExpiresAt).
+		Select("used_at").To(&l.UsedAt).
+		Where("link_id = ?", linkID).
+		Clause("FOR UPDATE")
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, auth.ErrMagicLinkInvalid
+		}
+		return nil, storage.InternalError(err)
+	}
+	return l, nil
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, l *auth.MagicLink) error {
+	dbState, err := s.GetByID(ctx, l.LinkID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, l)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("magic_links").Where("link_id = ?", l.LinkID)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, auth.ErrMagicLinkInvalid); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(l)
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
@@ -0,0 +1,97 @@
+package mfachallengestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, c *auth.SecondFactorChallenge) error {
+	q := sqlf.InsertInto("mfa_challenges").
+		Set("challenge_id", c.ChallengeID).
+		Set("user_id", c.UserID).
+		Set("created_at", c.CreatedAt).
+		Set("expires_at", c.ExpiresAt).
+		Set("failures", c.Failures).
+		Set("used_at", c.UsedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+
+	s.base.MarkSeen(c)
+	return nil
+}
+
+// GetByID returns the challenge and locks it until the end of the
+// transaction, so concurrent attempts can't use it twice or lose failures.
+func (s *PostgresStorage) GetByID(ctx context.Context, challengeID string) (*auth.SecondFactorChallenge, error) {
+	c := &auth.SecondFactorChallenge{}
+	q := sqlf.From("mfa_challenges").
+		Select("challenge_id").To(&c.ChallengeID).
+		Select("user_id").To(&c.UserID).
+		Select("created_at").To(&c.CreatedAt).
+		Select("expires_at").To(&c.ExpiresAt).
+		Select("failures").To(&c.Failures).
+		Select("used_at").To(&c.UsedAt).
+		Where("challenge_id = ?", challengeID).
+		Clause("FOR UPDATE")
+
+	if err := q.QueryRowAndClose(ctx, s.base.DB); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, auth.ErrChallengeInvalid
+		}
+		return nil, storage.InternalError(err)
+	}
+	return c, nil
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, c *auth.SecondFactorChallenge) error {
+	dbState, err := s.GetByID(ctx, c.ChallengeID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, c)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("mfa_challenges").Where("challenge_id = ?", c.ChallengeID)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, auth.ErrChallengeInvalid); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(c)
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
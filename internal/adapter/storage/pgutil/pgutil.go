@@ -5,7 +5,6 @@ import (
 	"errors"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
 	"github.com/burenotti/go_health_backend/internal/domain"
-	"github.com/burenotti/go_health_backend/internal/domain/auth"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/leporo/sqlf"
@@ -13,23 +12,30 @@ import (
 	"sync"
 )
 
+type Aggregate interface {
+	PopEvents() []domain.Event
+}
+
 type BasePostgresStorage struct {
 	DB     storage.DBContext
 	seenMu sync.Mutex
-	seen   map[string]*auth.User
+	seen   map[Aggregate]struct{}
 }
 
 func NewBasePostgresStorage(db storage.DBContext) *BasePostgresStorage {
 	return &BasePostgresStorage{
-		DB: db,
+		DB:   db,
+		seen: make(map[Aggregate]struct{}),
 	}
 }
 
 func (s *BasePostgresStorage) CollectEvents() []domain.Event {
+	s.seenMu.Lock()
 	var events []domain.Event
-	for _, u := range s.seen {
-		events = append(events, u.PopEvents()...)
+	for a := range s.seen {
+		events = append(events, a.PopEvents()...)
 	}
+	s.seenMu.Unlock()
 	s.clearSeen()
 	return events
 }
@@ -38,14 +44,14 @@ func (s *BasePostgresStorage) Close() {
 	s.clearSeen()
 }
 
-func (s *BasePostgresStorage) MarkSeen(u *auth.User) {
+func (s *BasePostgresStorage) MarkSeen(a Aggregate) {
 	s.seenMu.Lock()
-	s.seen[u.UserID] = u
+	s.seen[a] = struct{}{}
 	s.seenMu.Unlock()
 }
 func (s *BasePostgresStorage) clearSeen() {
 	s.seenMu.Lock()
-	s.seen = make(map[string]*auth.User)
+	s.seen = make(map[Aggregate]struct{})
 	s.seenMu.Unlock()
 }
 
@@ -9,6 +9,7 @@ import (
 	"github.com/burenotti/go_health_backend/internal/domain"
 	"github.com/burenotti/go_health_backend/internal/domain/profile"
 	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
 	"time"
 )
 
@@ -25,15 +26,15 @@ func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
 func (s *PostgresStorage) Add(ctx context.Context, p profile.Profile) error {
 	switch v := p.(type) {
 	case *profile.Coach:
-		return s.AddTrainee(ctx, v)
-	case *profile.Trainee:
 		return s.AddCoach(ctx, v)
+	case *profile.Trainee:
+		return s.AddTrainee(ctx, v)
 	default:
 		panic("unknown profile type")
 	}
 }
 
-func (s *PostgresStorage) AddCoach(ctx context.Context, t *profile.Trainee) error {
+func (s *PostgresStorage) AddTrainee(ctx context.Context, t *profile.Trainee) error {
 	q := sqlf.InsertInto("trainees_profiles").
 		Set("user_id", t.UserID).
 		Set("first_name", t.FirstName).
@@ -50,7 +51,7 @@ func (s *PostgresStorage) AddCoach(ctx context.Context, t *profile.Trainee) erro
 	return nil
 }
 
-func (s *PostgresStorage) AddTrainee(ctx context.Context, c *profile.Coach) error {
+func (s *PostgresStorage) AddCoach(ctx context.Context, c *profile.Coach) error {
 	q := sqlf.InsertInto("coaches_profiles").
 		Set("user_id", c.UserID).
 		Set("first_name", c.FirstName).
@@ -60,7 +61,7 @@ func (s *PostgresStorage) AddTrainee(ctx context.Context, c *profile.Coach) erro
 		Set("bio", c.Bio)
 
 	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
-		if pgutil.ViolatesConstraint(err, "trainee_profiles_pkey") {
+		if pgutil.ViolatesConstraint(err, "coaches_profiles_pkey") {
 			return profile.ErrProfileExists
 		}
 		return err
@@ -128,24 +129,50 @@ func (s *PostgresStorage) Persist(ctx context.Context, p profile.Profile) error
 }
 
 func (s *PostgresStorage) PersistTrainee(ctx context.Context, t *profile.Trainee) error {
-	q := sqlf.Update("trainees_profiles").
-		Where("user_id = ?", t.UserID).
-		Set("first_name", t.FirstName).
-		Set("last_name", t.LastName).
-		Set("last_name", t.BirthDate)
+	dbState, err := s.GetByID(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	if _, ok := dbState.(*profile.Trainee); !ok {
+		return profile.ErrProfileNotFound
+	}
 
-	res, err := q.ExecAndClose(ctx, s.base.DB)
-	return pgutil.AssertUpdated(res, err, profile.ErrProfileNotFound)
+	if err := s.persist(ctx, "trainees_profiles", t.UserID, dbState, t); err != nil {
+		return err
+	}
+
+	s.base.MarkSeen(t)
+	return nil
 }
 
 func (s *PostgresStorage) PersistCoach(ctx context.Context, c *profile.Coach) error {
-	q := sqlf.Update("coaches_profiles").
-		Where("user_id = ?", c.UserID).
-		Set("first_name", c.FirstName).
-		Set("last_name", c.LastName).
-		Set("last_name", c.BirthDate).
-		Set("bio", c.Bio).
-		Set("years_experience", c.YearsExperience)
+	dbState, err := s.GetByID(ctx, c.UserID)
+	if err != nil {
+		return err
+	}
+	if _, ok := dbState.(*profile.Coach); !ok {
+		return profile.ErrProfileNotFound
+	}
+
+	if err := s.persist(ctx, "coaches_profiles", c.UserID, dbState, c); err != nil {
+		return err
+	}
+
+	s.base.MarkSeen(c)
+	return nil
+}
+
+func (s *PostgresStorage) persist(ctx context.Context, table, userID string, dbState, p profile.Profile) error {
+	log, err := diff.Diff(dbState, p)
+	if err != nil {
+		panic(err) // should never happen
+	}
+	if len(log) == 0 {
+		return nil
+	}
+
+	q := sqlf.Update(table).Where("user_id = ?", userID)
+	q = pgutil.MakeUpdateQuery(q, log)
 
 	res, err := q.ExecAndClose(ctx, s.base.DB)
 	return pgutil.AssertUpdated(res, err, profile.ErrProfileNotFound)
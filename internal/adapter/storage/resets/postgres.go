@@ -0,0 +1,143 @@
+package resetstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+	"github.com/samber/lo"
+	"time"
+)
+
+type PostgresStorage struct {
+	base *pgutil.BasePostgresStorage
+}
+
+func NewPostgresStorage(db storage.DBContext) *PostgresStorage {
+	return &PostgresStorage{
+		base: pgutil.NewBasePostgresStorage(db),
+	}
+}
+
+func (s *PostgresStorage) Add(ctx context.Context, r *auth.PasswordReset) error {
+	q := sqlf.InsertInto("password_resets").
+		Set("reset_id", r.ResetID).
+		Set("user_id", r.UserID).
+		Set("token_hash", lo.EmptyableToPtr(r.TokenHash)).
+		Set("created_at", r.CreatedAt).
+		Set("expires_at", r.ExpiresAt).
+		Set("used_at", r.UsedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+
+	s.base.MarkSeen(r)
+	return nil
+}
+
+func (s *PostgresStorage) get(
+	ctx context.Context,
+	modify func(stmt *sqlf.Stmt) *sqlf.Stmt,
+) (map[string]*auth.PasswordReset, error) {
+	var tmp auth.PasswordReset
+
+	q := sqlf.From("password_resets r").
+		Select("r.reset_id").To(&tmp.ResetID).
+		Select("r.user_id").To(&tmp.UserID).
+		Select("coalesce(r.token_hash, '')").To(&tmp.TokenHash).
+		Select("r.created_at").To(&tmp.CreatedAt).
+		Select("r.expires_at").To(&tmp.ExpiresAt).
+		Select("r.used_at").To(&tmp.UsedAt)
+
+	q = modify(q)
+
+	result := make(map[string]*auth.PasswordReset)
+	err := q.QueryAndClose(ctx, s.base.DB, func(rows *sql.Rows) {
+		result[tmp.ResetID] = &auth.PasswordReset{
+			ResetID:   tmp.ResetID,
+			UserID:    tmp.UserID,
+			TokenHash: tmp.TokenHash,
+			CreatedAt: tmp.CreatedAt,
+			ExpiresAt: tmp.ExpiresAt,
+			UsedAt:    tmp.UsedAt,
+		}
+	})
+
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return result, nil
+	}
+
+	return nil, storage.InternalError(err)
+}
+
+// GetByID returns the reset and locks it until the end of the transaction,
+// so a token can't be issued twice concurrently.
+func (s *PostgresStorage) GetByID(ctx context.Context, resetID string) (*auth.PasswordReset, error) {
+	result, err := s.get(ctx, func(stmt *sqlf.Stmt) *sqlf.Stmt {
+		return stmt.Where("r.reset_id = ?", resetID).Clause("FOR UPDATE")
+	})
+	return pgutil.PeekOrErr(result, err, auth.ErrPasswordResetInvalid)
+}
+
+// GetByTokenHash returns the reset and locks it until the end of the
+// transaction, so a token can't be used twice concurrently.
+func (s *PostgresStorage) GetByTokenHash(ctx context.Context, tokenHash string) (*auth.PasswordReset, error) {
+	result, err := s.get(ctx, func(stmt *sqlf.Stmt) *sqlf.Stmt {
+		return stmt.Where("r.token_hash = ?", tokenHash).Clause("FOR UPDATE")
+	})
+	return pgutil.PeekOrErr(result, err, auth.ErrPasswordResetInvalid)
+}
+
+// ExpireOutstanding invalidates the unused resets of the user.
+func (s *PostgresStorage) ExpireOutstanding(ctx context.Context, userID string, now time.Time) error {
+	q := sqlf.Update("password_resets").
+		Set("expires_at", now).
+		Where("user_id = ?", userID).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", now)
+
+	if _, err := q.ExecAndClose(ctx, s.base.DB); err != nil {
+		return storage.InternalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) Persist(ctx context.Context, r *auth.PasswordReset) error {
+	dbState, err := s.GetByID(ctx, r.ResetID)
+	if err != nil {
+		return err
+	}
+
+	log, err := diff.Diff(dbState, r)
+	if err != nil {
+		panic(err) // should never happen
+	}
+
+	if len(log) != 0 {
+		q := sqlf.Update("password_resets").Where("reset_id = ?", r.ResetID)
+		q = pgutil.MakeUpdateQuery(q, log)
+
+		res, err := q.ExecAndClose(ctx, s.base.DB)
+		if err := pgutil.AssertUpdated(res, err, auth.ErrPasswordResetInvalid); err != nil {
+			return err
+		}
+	}
+
+	s.base.MarkSeen(r)
+	return nil
+}
+
+func (s *PostgresStorage) CollectEvents() []domain.Event {
+	return s.base.CollectEvents()
+}
+
+func (s *PostgresStorage) Close() error {
+	s.base.Close()
+	return nil
+}
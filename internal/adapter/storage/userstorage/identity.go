@@ -0,0 +1,106 @@
+package userstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+)
+
+func (s *PostgresStorage) GetByIdentity(ctx context.Context, provider, subject string) (*auth.User, error) {
+	users, err := s.get(
+		ctx,
+		"u.user_id = (SELECT user_id FROM external_identities WHERE provider = ? AND subject = ?)",
+		provider,
+		subject,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, auth.ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+func (s *PostgresStorage) loadIdentities(ctx context.Context, u *auth.User) error {
+	var tmp auth.ExternalIdentity
+	q := sqlf.From("external_identities").
+		Where("user_id = ?", u.UserID).
+		Select("provider").To(&tmp.Provider).
+		Select("subject").To(&tmp.Subject).
+		Select("email").To(&tmp.Email).
+		Select("created_at").To(&tmp.CreatedAt)
+
+	err := q.QueryAndClose(ctx, s.db, func(rows *sql.Rows) {
+		i := tmp
+		u.Identities = append(u.Identities, &i)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return internalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) addIdentity(ctx context.Context, userId string, i *auth.ExternalIdentity) error {
+	q := sqlf.InsertInto("external_identities").
+		Set("provider", i.Provider).
+		Set("subject", i.Subject).
+		Set("user_id", userId).
+		Set("email", i.Email).
+		Set("created_at", i.CreatedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return auth.ErrIdentityLinked
+		}
+		return internalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) persistIdentities(ctx context.Context, userId string, source, changed []*auth.ExternalIdentity) error {
+	type key struct{ provider, subject string }
+
+	dbIdentities := make(map[key]*auth.ExternalIdentity)
+	for _, i := range source {
+		dbIdentities[key{i.Provider, i.Subject}] = i
+	}
+
+	for _, i := range changed {
+		k := key{i.Provider, i.Subject}
+		dbIdentity, ok := dbIdentities[k]
+		delete(dbIdentities, k)
+
+		if !ok {
+			if err := s.addIdentity(ctx, userId, i); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if log, _ := diff.Diff(dbIdentity, i); len(log) != 0 {
+			q := sqlf.Update("external_identities").
+				Where("provider = ? AND subject = ?", i.Provider, i.Subject)
+			q = pgutil.MakeUpdateQuery(q, log)
+			if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+				return internalError(err)
+			}
+		}
+	}
+
+	for k := range dbIdentities {
+		q := sqlf.DeleteFrom("external_identities").
+			Where("provider = ? AND subject = ?", k.provider, k.subject)
+		if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+			return internalError(err)
+		}
+	}
+	return nil
+}
@@ -13,7 +13,10 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/leporo/sqlf"
 	"github.com/r3labs/diff"
+	"github.com/samber/lo"
 	"log/slog"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -44,10 +47,17 @@ func (s *PostgresStorage) Add(ctx context.Context, u *auth.User) error {
 		Set("user_id", u.UserID).
 		Set("email", u.Email).
 		Set("password_hash", u.PasswordHash).
+		Set("verified_at", u.VerifiedAt).
 		Set("created_at", u.CreatedAt).
-		Set("updated_at", u.UpdatedAt)
+		Set("updated_at", u.UpdatedAt).
+		Set("deleted_at", u.DeletedAt).
+		Set("role", u.Role).
+		Set("locked_at", u.LockedAt)
 
 	if _, err := q.Exec(ctx, s.db); err != nil {
+		if isEmailDuplicated(err) {
+			return errors.Join(fmt.Errorf("email is taken: %w", err), auth.ErrUserEmailDuplicate)
+		}
 		if isUserDuplicated(err) {
 			return errors.Join(fmt.Errorf("user exists: %w", err), auth.ErrUserExists)
 		}
@@ -60,6 +70,18 @@ func (s *PostgresStorage) Add(ctx context.Context, u *auth.User) error {
 		}
 	}
 
+	if u.TOTP != nil {
+		if err := s.addTOTP(ctx, u.UserID, u.TOTP); err != nil {
+			return err
+		}
+	}
+
+	for _, i := range u.Identities {
+		if err := s.addIdentity(ctx, u.UserID, i); err != nil {
+			return err
+		}
+	}
+
 	s.markSeen(u)
 
 	return nil
@@ -68,8 +90,10 @@ func (s *PostgresStorage) Add(ctx context.Context, u *auth.User) error {
 func (s *PostgresStorage) addAuth(ctx context.Context, userId string, a *auth.Authorization) error {
 	addAuth := sqlf.InsertInto("authorizations").
 		Set("authorization_id", a.ID).
+		Set("family_id", a.FamilyID).
 		Set("secret", a.Secret).
 		Set("logout_at", a.LogoutAt).
+		Set("rotated_at", a.RotatedAt).
 		Set("created_at", a.CreatedAt).
 		Set("valid_until", a.ValidUntil).
 		Set("user_id", userId)
@@ -78,8 +102,11 @@ func (s *PostgresStorage) addAuth(ctx context.Context, userId string, a *auth.Au
 		Set("authorization_id", a.ID).
 		Set("os", a.Device.OS).
 		Set("device_model", a.Device.Model).
-		Set("ip_address", a.Device.IPAddress).
-		Set("browser", a.Device.Browser)
+		Set("ip_address", lo.EmptyableToPtr(a.Device.IPAddress)).
+		Set("browser", a.Device.Browser).
+		Set("country", a.Device.Country).
+		Set("asn", a.Device.ASN).
+		Set("as_org", a.Device.ASOrg)
 
 	if _, err := addAuth.Exec(ctx, s.db); err != nil {
 		var pgErr *pgconn.PgError
@@ -119,17 +146,26 @@ func (s *PostgresStorage) get(
 		Select("u.user_id").To(&tmp.UserID).
 		Select("u.email").To(&tmp.Email).
 		Select("u.password_hash").To(&tmp.PasswordHash).
+		Select("u.verified_at").To(&tmp.VerifiedAt).
 		Select("u.created_at").To(&tmp.CreatedAt).
 		Select("u.updated_at").To(&tmp.UpdatedAt).
+		Select("u.deleted_at").To(&tmp.DeletedAt).
+		Select("u.role").To(&tmp.Role).
+		Select("u.locked_at").To(&tmp.LockedAt).
 		Select("a.authorization_id").To(&tmp.AuthorizationID).
+		Select("a.family_id").To(&tmp.FamilyID).
 		Select("a.secret").To(&tmp.Secret).
 		Select("a.valid_until").To(&tmp.AuthValidUntil).
 		Select("a.logout_at").To(&tmp.LogoutAt).
+		Select("a.rotated_at").To(&tmp.RotatedAt).
 		Select("a.created_at").To(&tmp.AuthCreatedAt).
 		Select("d.os").To(&tmp.OS).
 		Select("d.browser").To(&tmp.Browser).
 		Select("d.device_model").To(&tmp.Model).
-		Select("d.ip_address").To(&tmp.IpAddress)
+		Select("host(d.ip_address)").To(&tmp.IpAddress).
+		Select("d.country").To(&tmp.Country).
+		Select("d.asn").To(&tmp.ASN).
+		Select("d.as_org").To(&tmp.ASOrg)
 
 	var fetchedRows []userWithAuthRow
 
@@ -144,7 +180,17 @@ func (s *PostgresStorage) get(
 		return nil, internalError(err)
 	}
 
-	return rowsToDomain(fetchedRows), outErr
+	users = rowsToDomain(fetchedRows)
+	for _, u := range users {
+		if err := s.loadTOTP(ctx, u); err != nil {
+			return nil, err
+		}
+		if err := s.loadIdentities(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, outErr
 }
 
 func (s *PostgresStorage) GetByEmail(ctx context.Context, email string) (*auth.User, error) {
@@ -180,8 +226,24 @@ func (s *PostgresStorage) GetByAuthID(ctx context.Context, id string) (*auth.Use
 	return users[0], nil
 }
 
+// GetByAuthSecret returns the owner of the authorization and locks the
+// authorization until the end of the transaction, so concurrent refreshes
+// with the same token are serialized and the later one sees it rotated.
 func (s *PostgresStorage) GetByAuthSecret(ctx context.Context, secret string) (*auth.User, error) {
-	users, err := s.get(ctx, "a.secret = ? ", secret)
+	var userId string
+	lock := sqlf.From("authorizations").
+		Where("secret = ?", secret).
+		Select("user_id").To(&userId).
+		Clause("FOR UPDATE")
+
+	if err := lock.QueryRowAndClose(ctx, s.db); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, auth.ErrUserNotFound
+		}
+		return nil, internalError(err)
+	}
+
+	users, err := s.get(ctx, "u.user_id = ?", userId)
 	if err != nil {
 		return nil, err
 	}
@@ -191,23 +253,71 @@ func (s *PostgresStorage) GetByAuthSecret(ctx context.Context, secret string) (*
 	return users[0], nil
 }
 
+// SearchByEmail returns the users whose email contains the query, ordered by
+// email.
+func (s *PostgresStorage) SearchByEmail(ctx context.Context, query string, limit, offset int) ([]*auth.User, error) {
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	page := "SELECT user_id FROM users WHERE email ILIKE ? ORDER BY email"
+	args := []any{pattern}
+	if limit > 0 {
+		page += " LIMIT ?"
+		args = append(args, limit)
+	}
+	if offset > 0 {
+		page += " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	users, err := s.get(ctx, "u.user_id IN ("+page+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+	return users, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s *PostgresStorage) IsAuthorizationRevoked(ctx context.Context, authId string) (bool, error) {
+	var logoutAt *time.Time
+	q := sqlf.From("authorizations").
+		Where("authorization_id = ?", authId).
+		Select("logout_at").To(&logoutAt)
+
+	if err := q.QueryRowAndClose(ctx, s.db); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, internalError(err)
+	}
+
+	return logoutAt != nil, nil
+}
+
 func (s *PostgresStorage) Persist(ctx context.Context, u *auth.User) error {
 	dbState, err := s.GetByID(ctx, u.UserID)
 	if err != nil {
 		return err
 	}
 
-	if log, _ := diff.Diff(u, dbState); len(log) != 0 {
+	if log, _ := diff.Diff(dbState, u); len(log) != 0 {
 		q := sqlf.Update("users").Where("user_id = ?", u.UserID)
 		q = pgutil.MakeUpdateQuery(q, log)
 
 		res, err := q.Exec(ctx, s.db)
 		if err != nil {
+			if isEmailDuplicated(err) {
+				return errors.Join(fmt.Errorf("email is taken: %w", err), auth.ErrUserEmailDuplicate)
+			}
 			return internalError(err)
 		}
 
-		affected, affErr := res.RowsAffected()
-		if affErr != nil {
+		affected, err := res.RowsAffected()
+		if err != nil {
 			return internalError(err)
 		}
 
@@ -233,9 +343,45 @@ func (s *PostgresStorage) Persist(ctx context.Context, u *auth.User) error {
 		}
 	}
 
+	if err := s.persistTOTP(ctx, u.UserID, dbState.TOTP, u.TOTP); err != nil {
+		return err
+	}
+
+	if err := s.persistIdentities(ctx, u.UserID, dbState.Identities, u.Identities); err != nil {
+		return err
+	}
+
+	s.markSeen(u)
+
 	return nil
 }
 
+// Delete removes the user together with everything that references it.
+func (s *PostgresStorage) Delete(ctx context.Context, userId string) error {
+	q := sqlf.DeleteFrom("users").Where("user_id = ?", userId)
+
+	res, err := q.ExecAndClose(ctx, s.db)
+	return pgutil.AssertUpdated(res, err, auth.ErrUserNotFound)
+}
+
+// PurgeDeleted removes the users deleted before the given moment.
+func (s *PostgresStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	q := sqlf.DeleteFrom("users").
+		Where("deleted_at IS NOT NULL").
+		Where("deleted_at < ?", before)
+
+	res, err := q.ExecAndClose(ctx, s.db)
+	if err != nil {
+		return 0, internalError(err)
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, internalError(err)
+	}
+	return purged, nil
+}
+
 func (s *PostgresStorage) CollectEvents() []domain.Event {
 	var events []domain.Event
 	for _, u := range s.seen {
@@ -280,6 +426,12 @@ func (s *PostgresStorage) persistDevice(ctx context.Context, id string, source,
 		return nil
 	}
 
+	for i := range log {
+		if log[i].Path[0] == "ip_address" && log[i].To == "" {
+			log[i].To = nil
+		}
+	}
+
 	q := sqlf.Update("devices").Where("authorization_id = ?", id)
 	q = pgutil.MakeUpdateQuery(q, log)
 
@@ -297,6 +449,14 @@ func isUserDuplicated(err error) bool {
 	return pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) && pgErr.ConstraintName == "users_pkey"
 }
 
+func isEmailDuplicated(err error) bool {
+	pgErr := &pgconn.PgError{}
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == "users_lower_email_key"
+}
+
 func internalError(err error) error {
 	return errors.Join(fmt.Errorf("internal storage error: %w", err), ErrInternal)
 }
@@ -305,12 +465,18 @@ type userWithAuthRow struct {
 	UserID       string
 	Email        string
 	PasswordHash string
+	VerifiedAt   *time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	DeletedAt    *time.Time
+	Role         string
+	LockedAt     *time.Time
 
 	AuthorizationID *string
+	FamilyID        *string
 	Secret          *string
 	LogoutAt        *time.Time
+	RotatedAt       *time.Time
 	AuthCreatedAt   *time.Time
 	AuthValidUntil  *time.Time
 
@@ -318,6 +484,9 @@ type userWithAuthRow struct {
 	Browser   *string
 	OS        *string
 	Model     *string
+	Country   *string
+	ASN       *uint32
+	ASOrg     *string
 }
 
 func rowsToDomain(rows []userWithAuthRow) []*auth.User {
@@ -329,22 +498,32 @@ func rowsToDomain(rows []userWithAuthRow) []*auth.User {
 				UserID:         row.UserID,
 				Email:          row.Email,
 				PasswordHash:   row.PasswordHash,
-				CreatedAt:      time.Time{},
-				UpdatedAt:      time.Time{},
+				VerifiedAt:     row.VerifiedAt,
+				CreatedAt:      row.CreatedAt,
+				UpdatedAt:      row.UpdatedAt,
+				DeletedAt:      row.DeletedAt,
+				Role:           row.Role,
+				LockedAt:       row.LockedAt,
 				Authorizations: make([]*auth.Authorization, 0),
 			}
 		}
 		if row.AuthorizationID != nil {
 			a := &auth.Authorization{
 				ID:         *row.AuthorizationID,
+				FamilyID:   *row.FamilyID,
 				Secret:     *row.Secret,
 				CreatedAt:  *row.AuthCreatedAt,
 				ValidUntil: *row.AuthValidUntil,
 				LogoutAt:   row.LogoutAt,
+				RotatedAt:  row.RotatedAt,
 				Device: auth.Device{
 					Browser:   *row.Browser,
 					OS:        *row.OS,
-					IPAddress: *row.IpAddress,
+					IPAddress: lo.FromPtr(row.IpAddress),
+					Model:     *row.Model,
+					Country:   *row.Country,
+					ASN:       *row.ASN,
+					ASOrg:     *row.ASOrg,
 				},
 			}
 			usersMap[row.UserID].Authorizations = append(usersMap[row.UserID].Authorizations, a)
@@ -365,17 +544,26 @@ func domainToRows(user *auth.User) (res []userWithAuthRow) {
 			UserID:          user.UserID,
 			Email:           user.Email,
 			PasswordHash:    user.PasswordHash,
+			VerifiedAt:      user.VerifiedAt,
 			CreatedAt:       user.CreatedAt,
 			UpdatedAt:       user.UpdatedAt,
+			DeletedAt:       user.DeletedAt,
+			Role:            user.Role,
+			LockedAt:        user.LockedAt,
 			AuthorizationID: &a.ID,
+			FamilyID:        &a.FamilyID,
 			Secret:          &a.Secret,
 			LogoutAt:        a.LogoutAt,
+			RotatedAt:       a.RotatedAt,
 			AuthCreatedAt:   &a.CreatedAt,
 			AuthValidUntil:  &a.ValidUntil,
 			IpAddress:       &a.Device.IPAddress,
 			Browser:         &a.Device.Browser,
 			OS:              &a.Device.OS,
 			Model:           &a.Device.Model,
+			Country:         &a.Device.Country,
+			ASN:             &a.Device.ASN,
+			ASOrg:           &a.Device.ASOrg,
 		}
 		res = append(res, t)
 	}
@@ -0,0 +1,140 @@
+package userstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/pgutil"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/leporo/sqlf"
+	"github.com/r3labs/diff"
+	"time"
+)
+
+func (s *PostgresStorage) loadTOTP(ctx context.Context, u *auth.User) error {
+	var t auth.TOTP
+	q := sqlf.From("totp_secrets").
+		Where("user_id = ?", u.UserID).
+		Select("secret").To(&t.Secret).
+		Select("created_at").To(&t.CreatedAt).
+		Select("confirmed_at").To(&t.ConfirmedAt).
+		Select("last_used_step").To(&t.LastUsedStep)
+
+	if err := q.QueryRowAndClose(ctx, s.db); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return internalError(err)
+	}
+
+	var tmp struct {
+		Hash   string
+		UsedAt *time.Time
+	}
+	codes := sqlf.From("recovery_codes").
+		Where("user_id = ?", u.UserID).
+		Select("code_hash").To(&tmp.Hash).
+		Select("used_at").To(&tmp.UsedAt)
+
+	err := codes.QueryAndClose(ctx, s.db, func(rows *sql.Rows) {
+		t.RecoveryCodes = append(t.RecoveryCodes, &auth.RecoveryCode{
+			Hash:   tmp.Hash,
+			UsedAt: tmp.UsedAt,
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return internalError(err)
+	}
+
+	u.TOTP = &t
+	return nil
+}
+
+func (s *PostgresStorage) addTOTP(ctx context.Context, userId string, t *auth.TOTP) error {
+	q := sqlf.InsertInto("totp_secrets").
+		Set("user_id", userId).
+		Set("secret", t.Secret).
+		Set("created_at", t.CreatedAt).
+		Set("confirmed_at", t.ConfirmedAt).
+		Set("last_used_step", t.LastUsedStep)
+
+	if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+		return internalError(err)
+	}
+
+	for _, code := range t.RecoveryCodes {
+		if err := s.addRecoveryCode(ctx, userId, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStorage) addRecoveryCode(ctx context.Context, userId string, code *auth.RecoveryCode) error {
+	q := sqlf.InsertInto("recovery_codes").
+		Set("user_id", userId).
+		Set("code_hash", code.Hash).
+		Set("used_at", code.UsedAt)
+
+	if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+		return internalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) deleteTOTP(ctx context.Context, userId string) error {
+	q := sqlf.DeleteFrom("totp_secrets").Where("user_id = ?", userId)
+	if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+		return internalError(err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) persistTOTP(ctx context.Context, userId string, source, changed *auth.TOTP) error {
+	switch {
+	case source == nil && changed == nil:
+		return nil
+	case source == nil:
+		return s.addTOTP(ctx, userId, changed)
+	case changed == nil:
+		return s.deleteTOTP(ctx, userId)
+	case source.Secret != changed.Secret:
+		if err := s.deleteTOTP(ctx, userId); err != nil {
+			return err
+		}
+		return s.addTOTP(ctx, userId, changed)
+	}
+
+	if log, _ := diff.Diff(source, changed); len(log) != 0 {
+		q := sqlf.Update("totp_secrets").Where("user_id = ?", userId)
+		q = pgutil.MakeUpdateQuery(q, log)
+		if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+			return internalError(err)
+		}
+	}
+
+	dbCodes := make(map[string]*auth.RecoveryCode)
+	for _, code := range source.RecoveryCodes {
+		dbCodes[code.Hash] = code
+	}
+
+	for _, code := range changed.RecoveryCodes {
+		dbCode, ok := dbCodes[code.Hash]
+		if !ok {
+			if err := s.addRecoveryCode(ctx, userId, code); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if log, _ := diff.Diff(dbCode, code); len(log) != 0 {
+			q := sqlf.Update("recovery_codes").
+				Where("user_id = ? AND code_hash = ?", userId, code.Hash)
+			q = pgutil.MakeUpdateQuery(q, log)
+			if _, err := q.ExecAndClose(ctx, s.db); err != nil {
+				return internalError(err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package accountapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrInvalidTransferTarget = errors.New("groups can only be transferred to another coach")
+)
+
+type Service struct {
+	logger           *slog.Logger
+	authorizer       auth.Authorizer
+	gracePeriod      time.Duration
+	attemptRetention time.Duration
+}
+
+type ServiceOption func(*Service)
+
+// AttemptRetention sets how long failed logins are kept after the last one.
+// It must not be shorter than the windows of the lockout policies.
+func AttemptRetention(d time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.attemptRetention = d
+	}
+}
+
+// New creates the service. Deleted accounts stay anonymized for gracePeriod
+// before they are purged; a zero grace period purges them right away.
+func New(authorizer auth.Authorizer, gracePeriod time.Duration, logger *slog.Logger, opts ...ServiceOption) *Service {
+	s := &Service{
+		logger:           logger,
+		authorizer:       authorizer,
+		gracePeriod:      gracePeriod,
+		attemptRetention: 24 * time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// DeleteAccount anonymizes the user and the profile and takes the user out
+// of every group. Groups of a coach are transferred to transferTo, or
+// archived when it is empty.
+func (s *Service) DeleteAccount(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	r auth.Reauthentication,
+	transferTo string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		if err := u.Delete(s.authorizer, r); err != nil {
+			return err
+		}
+
+		p, err := ctx.ProfileStorage.GetByID(ctx.Context(), userId)
+		if err != nil && !errors.Is(err, profile.ErrProfileNotFound) {
+			return err
+		}
+
+		if p != nil {
+			if err := s.releaseGroups(ctx, p, transferTo); err != nil {
+				return err
+			}
+
+			p.Anonymize()
+			if err := ctx.ProfileStorage.Persist(ctx.Context(), p); err != nil {
+				return err
+			}
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		if s.gracePeriod == 0 {
+			if err := ctx.UserStorage.Delete(ctx.Context(), userId); err != nil {
+				return err
+			}
+		}
+
+		return ctx.Commit()
+	})
+}
+
+func (s *Service) releaseGroups(ctx *AtomicContext, p profile.Profile, transferTo string) error {
+	if p.Type() == profile.TypeTrainee {
+		return ctx.GroupStorage.RemoveTrainee(ctx.Context(), group.TraineeID(p.ID()))
+	}
+
+	if transferTo != "" {
+		if transferTo == p.ID() {
+			return ErrInvalidTransferTarget
+		}
+
+		target, err := ctx.ProfileStorage.GetByID(ctx.Context(), transferTo)
+		if errors.Is(err, profile.ErrProfileNotFound) {
+			return ErrInvalidTransferTarget
+		}
+		if err != nil {
+			return err
+		}
+		if target.Type() != profile.TypeCoach {
+			return ErrInvalidTransferTarget
+		}
+	}
+
+	groups, err := ctx.GroupStorage.ListByCoach(ctx.Context(), group.CoachID(p.ID()), 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		if transferTo != "" && !g.IsArchived() {
+			if err := g.TransferTo(group.CoachID(transferTo)); err != nil {
+				return err
+			}
+		} else {
+			g.Archive()
+		}
+
+		if err := ctx.GroupStorage.Persist(ctx.Context(), g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeDeleted removes the accounts whose grace period is over. Their audit
+// log entries are kept but stripped of personal data.
+func (s *Service) PurgeDeleted(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+) (purged int64, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		before := time.Now().UTC().Add(-s.gracePeriod)
+		if err := ctx.AuditStorage.AnonymizeDeleted(ctx.Context(), before); err != nil {
+			return err
+		}
+
+		var err error
+		purged, err = ctx.UserStorage.PurgeDeleted(ctx.Context(), before)
+		if err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+// PurgeAttempts removes the failed login counters that no longer affect
+// throttling.
+func (s *Service) PurgeAttempts(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+) (purged int64, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		now := time.Now().UTC()
+
+		var err error
+		purged, err = ctx.AttemptStorage.DeleteExpired(ctx.Context(), now, now.Add(-s.attemptRetention))
+		if err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+// RunPurge calls PurgeDeleted and PurgeAttempts every interval until ctx is
+// done.
+func (s *Service) RunPurge(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	interval time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeDeleted(ctx, uow)
+			if err != nil {
+				s.logger.Error("failed to purge deleted accounts", "error", err)
+				continue
+			}
+			if purged > 0 {
+				s.logger.Info("purged deleted accounts", "count", purged)
+			}
+
+			purged, err = s.PurgeAttempts(ctx, uow)
+			if err != nil {
+				s.logger.Error("failed to purge login attempts", "error", err)
+				continue
+			}
+			if purged > 0 {
+				s.logger.Info("purged login attempts", "count", purged)
+			}
+		}
+	}
+}
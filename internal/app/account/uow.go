@@ -0,0 +1,146 @@
+package accountapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	attemptstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/attempts"
+	auditstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/audit"
+	groupstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/groups"
+	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"time"
+)
+
+type UserStorage interface {
+	GetByID(ctx context.Context, userId string) (*auth.User, error)
+	Persist(ctx context.Context, u *auth.User) error
+	Delete(ctx context.Context, userId string) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type ProfileStorage interface {
+	GetByID(ctx context.Context, userId string) (profile.Profile, error)
+	Persist(ctx context.Context, p profile.Profile) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type GroupStorage interface {
+	ListByCoach(
+		ctx context.Context,
+		coachID group.CoachID,
+		limit, offset int,
+	) (map[group.GroupID]*group.Group, error)
+	Persist(ctx context.Context, g *group.Group) error
+	RemoveTrainee(ctx context.Context, traineeID group.TraineeID) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AttemptStorage interface {
+	DeleteExpired(ctx context.Context, now, before time.Time) (int64, error)
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AuditStorage interface {
+	Add(ctx context.Context, e *audit.Entry) error
+	AnonymizeDeleted(ctx context.Context, before time.Time) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AtomicContext struct {
+	ctx context.Context
+	storage.DBContext
+	UserStorage    UserStorage
+	ProfileStorage ProfileStorage
+	GroupStorage   GroupStorage
+	AttemptStorage AttemptStorage
+	AuditStorage   AuditStorage
+
+	events []domain.Event
+}
+
+func (a *AtomicContext) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AtomicContext) Commit() error {
+	events := a.collectEvents()
+	a.events = append(a.events, events...)
+	if err := auditapp.RecordEvents(a.ctx, a.AuditStorage, events); err != nil {
+		return err
+	}
+	return a.DBContext.Commit()
+}
+
+func (a *AtomicContext) Close() (err error) {
+	if closeErr := a.UserStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.ProfileStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.GroupStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AttemptStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AuditStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		err = errors.Join(fmt.Errorf("failed to close storage"), err)
+	}
+
+	return err
+}
+
+func (a *AtomicContext) CollectEvents() []domain.Event {
+	events := append(a.events, a.collectEvents()...)
+	a.events = nil
+	return events
+}
+
+func (a *AtomicContext) collectEvents() []domain.Event {
+	userEvents := a.UserStorage.CollectEvents()
+	profileEvents := a.ProfileStorage.CollectEvents()
+	groupEvents := a.GroupStorage.CollectEvents()
+	attemptEvents := a.AttemptStorage.CollectEvents()
+
+	events := make([]domain.Event, 0, len(userEvents)+len(profileEvents)+len(groupEvents)+len(attemptEvents))
+	events = append(events, userEvents...)
+	events = append(events, profileEvents...)
+	events = append(events, groupEvents...)
+	events = append(events, attemptEvents...)
+	return events
+}
+
+func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	return &AtomicContext{
+		ctx:            ctx,
+		DBContext:      dbContext,
+		UserStorage:    userstorage.NewPostgresStorage(dbContext, nil),
+		ProfileStorage: profilestorage.NewPostgresStorage(dbContext),
+		GroupStorage:   groupstorage.NewPostgresStorage(dbContext, nil),
+		AttemptStorage: attemptstorage.NewPostgresStorage(dbContext),
+		AuditStorage:   auditstorage.NewPostgresStorage(dbContext),
+	}, nil
+}
@@ -0,0 +1,435 @@
+package adminapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrAdminRequired     = errors.New("administrator role is required")
+	ErrOwnAccount        = errors.New("administrators can't do this to their own account")
+	ErrInvalidGroupOwner = errors.New("groups can only be owned by a coach")
+	ErrImpersonateAdmin  = errors.New("administrators can't be impersonated")
+	ErrSessionInactive   = errors.New("administrator session is not active")
+
+	ErrImpersonationDisabled = errors.New("impersonation is not configured")
+)
+
+const (
+	ActionUsersSearched   = "admin.users_searched"
+	ActionSessionsViewed  = "admin.sessions_viewed"
+	ActionSessionsRevoked = "admin.sessions_revoked"
+	ActionUserLocked      = "admin.user_locked"
+	ActionUserUnlocked    = "admin.user_unlocked"
+	ActionRoleChanged     = "admin.role_changed"
+	ActionGroupReassigned = "admin.group_reassigned"
+	ActionAuditViewed     = "admin.audit_viewed"
+	ActionImpersonated    = "admin.impersonated"
+)
+
+// Service runs the operator actions. Every action checks that the actor is
+// still an administrator and is written to the audit log in the same
+// transaction.
+type Service struct {
+	logger           *slog.Logger
+	authorizer       *authapp.Authorizer
+	impersonationTTL time.Duration
+}
+
+type ServiceOption func(*Service)
+
+// Impersonation enables Impersonate. The tokens it issues live for ttl.
+func Impersonation(authorizer *authapp.Authorizer, ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.authorizer = authorizer
+		s.impersonationTTL = ttl
+	}
+}
+
+func New(logger *slog.Logger, opts ...ServiceOption) *Service {
+	s := &Service{
+		logger:           logger,
+		impersonationTTL: 15 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Service) SearchUsers(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	email string,
+	limit, offset int,
+) (users []*auth.User, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		users, err = ctx.UserStorage.SearchByEmail(ctx.Context(), email, limit, offset)
+		if err != nil {
+			return err
+		}
+
+		return s.record(ctx, adminId, adminId, ActionUsersSearched, map[string]string{
+			"email": email,
+		})
+	})
+	return
+}
+
+// ListSessions returns the user together with the sessions, which are
+// available through User.Sessions.
+func (s *Service) ListSessions(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	userId string,
+) (u *auth.User, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		u, err = ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		return s.record(ctx, adminId, userId, ActionSessionsViewed, nil)
+	})
+	return
+}
+
+// ForceLogout closes every session of the user.
+func (s *Service) ForceLogout(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	userId string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		revoked := u.RevokeAllSessions()
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return s.record(ctx, adminId, userId, ActionSessionsRevoked, map[string]string{
+			"sessions": strconv.Itoa(revoked),
+		})
+	})
+}
+
+func (s *Service) LockUser(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	userId string,
+	reason string,
+) error {
+	if adminId == userId {
+		return ErrOwnAccount
+	}
+
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		u.Lock()
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return s.record(ctx, adminId, userId, ActionUserLocked, map[string]string{
+			"reason": reason,
+		})
+	})
+}
+
+// UnlockUser lifts the lock set by LockUser as well as the one caused by
+// failed logins.
+func (s *Service) UnlockUser(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	userId string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		u.Unlock()
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		attempts, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAccount, userId)
+		if err != nil {
+			return err
+		}
+		attempts.Reset()
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), attempts); err != nil {
+			return err
+		}
+
+		return s.record(ctx, adminId, userId, ActionUserUnlocked, nil)
+	})
+}
+
+func (s *Service) SetRole(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	userId string,
+	role string,
+) error {
+	if adminId == userId {
+		return ErrOwnAccount
+	}
+
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		return s.setRole(ctx, adminId, u, role)
+	})
+}
+
+// Bootstrap grants the role without an acting administrator. It is meant
+// for the command line, where the first administrator is created.
+func (s *Service) Bootstrap(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	email string,
+	role string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByEmail(ctx.Context(), email)
+		if err != nil {
+			return err
+		}
+
+		return s.setRole(ctx, "", u, role)
+	})
+}
+
+func (s *Service) setRole(ctx *AtomicContext, adminId string, u *auth.User, role string) error {
+	previous := u.Role
+	if err := u.SetRole(role); err != nil {
+		return err
+	}
+
+	if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+		return err
+	}
+
+	return s.record(ctx, adminId, u.UserID, ActionRoleChanged, map[string]string{
+		"from": previous,
+		"to":   role,
+	})
+}
+
+// ReassignGroup makes another coach the owner of the group.
+func (s *Service) ReassignGroup(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	groupId string,
+	coachId string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		g, err := ctx.GroupStorage.GetByID(ctx.Context(), group.GroupID(groupId))
+		if err != nil {
+			return err
+		}
+
+		coach, err := ctx.ProfileStorage.GetByID(ctx.Context(), coachId)
+		if errors.Is(err, profile.ErrProfileNotFound) {
+			return ErrInvalidGroupOwner
+		}
+		if err != nil {
+			return err
+		}
+		if coach.Type() != profile.TypeCoach {
+			return ErrInvalidGroupOwner
+		}
+
+		previous := g.CoachID
+		if err := g.TransferTo(group.CoachID(coachId)); err != nil {
+			return err
+		}
+		if err := ctx.GroupStorage.Persist(ctx.Context(), g); err != nil {
+			return err
+		}
+
+		// The new owner is recorded as the subject, the previous one may have
+		// been purged already.
+		return s.record(ctx, adminId, coachId, ActionGroupReassigned, map[string]string{
+			"group_id": groupId,
+			"from":     string(previous),
+		})
+	})
+}
+
+func (s *Service) ListAuditLog(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	filter audit.Filter,
+) (entries []*audit.Entry, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := s.requireAdmin(ctx, adminId); err != nil {
+			return err
+		}
+
+		entries, err = ctx.AuditStorage.List(ctx.Context(), filter)
+		if err != nil {
+			return err
+		}
+
+		subject := filter.UserID
+		if subject == "" {
+			subject = adminId
+		}
+		return s.record(ctx, adminId, subject, ActionAuditViewed, nil)
+	})
+	return
+}
+
+type ImpersonationToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// Impersonate issues an access token for the user that names the
+// administrator as the actor. The token is bound to the current session of
+// the administrator and can't be refreshed.
+func (s *Service) Impersonate(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	adminId string,
+	adminAuthId string,
+	userId string,
+	reason string,
+) (res ImpersonationToken, err error) {
+	if s.authorizer == nil {
+		return res, ErrImpersonationDisabled
+	}
+	if adminId == userId {
+		return res, ErrOwnAccount
+	}
+
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		admin, err := s.getAdmin(ctx, adminId)
+		if err != nil {
+			return err
+		}
+
+		session := admin.GetAuthByID(adminAuthId)
+		if session == nil || !session.IsActive() {
+			return ErrSessionInactive
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+		if u.DeletedAt != nil {
+			return auth.ErrUserNotFound
+		}
+		if u.IsAdmin() {
+			return ErrImpersonateAdmin
+		}
+
+		res.ExpiresAt = time.Now().UTC().Add(s.impersonationTTL)
+		res.AccessToken, err = s.authorizer.GenerateAccessToken(u, session, authapp.ActingAs(adminId, res.ExpiresAt))
+		if err != nil {
+			return err
+		}
+
+		return s.record(ctx, adminId, userId, ActionImpersonated, map[string]string{
+			"reason":     reason,
+			"expires_at": res.ExpiresAt.Format(time.RFC3339),
+		})
+	})
+	return
+}
+
+func (s *Service) requireAdmin(ctx *AtomicContext, adminId string) error {
+	_, err := s.getAdmin(ctx, adminId)
+	return err
+}
+
+func (s *Service) getAdmin(ctx *AtomicContext, adminId string) (*auth.User, error) {
+	u, err := ctx.UserStorage.GetByID(ctx.Context(), adminId)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return nil, ErrAdminRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAdmin() || u.IsLocked() || u.DeletedAt != nil {
+		return nil, ErrAdminRequired
+	}
+	return u, nil
+}
+
+// record writes the action to the audit log and commits the transaction.
+func (s *Service) record(ctx *AtomicContext, adminId, userId, action string, details map[string]string) error {
+	e := &audit.Entry{
+		UserID:    userId,
+		ActorID:   adminId,
+		Action:    action,
+		Details:   details,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := ctx.AuditStorage.Add(ctx.Context(), e); err != nil {
+		return err
+	}
+
+	s.logger.Info("admin action", "action", action, "admin_id", adminId, "user_id", userId)
+	return ctx.Commit()
+}
@@ -0,0 +1,136 @@
+package adminapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	attemptstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/attempts"
+	auditstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/audit"
+	groupstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/groups"
+	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+)
+
+type UserStorage interface {
+	GetByID(ctx context.Context, userId string) (*auth.User, error)
+	GetByEmail(ctx context.Context, email string) (*auth.User, error)
+	SearchByEmail(ctx context.Context, query string, limit, offset int) ([]*auth.User, error)
+	Persist(ctx context.Context, u *auth.User) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AttemptStorage interface {
+	Get(ctx context.Context, scope, subject string) (*auth.LoginAttempts, error)
+	Persist(ctx context.Context, l *auth.LoginAttempts) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type ProfileStorage interface {
+	GetByID(ctx context.Context, userId string) (profile.Profile, error)
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type GroupStorage interface {
+	GetByID(ctx context.Context, groupID group.GroupID) (*group.Group, error)
+	Persist(ctx context.Context, g *group.Group) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AuditStorage interface {
+	Add(ctx context.Context, e *audit.Entry) error
+	List(ctx context.Context, f audit.Filter) ([]*audit.Entry, error)
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AtomicContext struct {
+	ctx context.Context
+	storage.DBContext
+	UserStorage    UserStorage
+	AttemptStorage AttemptStorage
+	ProfileStorage ProfileStorage
+	GroupStorage   GroupStorage
+	AuditStorage   AuditStorage
+
+	events []domain.Event
+}
+
+func (a *AtomicContext) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AtomicContext) Commit() error {
+	events := a.collectEvents()
+	a.events = append(a.events, events...)
+	if err := auditapp.RecordEvents(a.ctx, a.AuditStorage, events); err != nil {
+		return err
+	}
+	return a.DBContext.Commit()
+}
+
+func (a *AtomicContext) Close() (err error) {
+	if closeErr := a.UserStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AttemptStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.ProfileStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.GroupStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AuditStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		err = errors.Join(fmt.Errorf("failed to close storage"), err)
+	}
+
+	return err
+}
+
+func (a *AtomicContext) CollectEvents() []domain.Event {
+	events := append(a.events, a.collectEvents()...)
+	a.events = nil
+	return events
+}
+
+func (a *AtomicContext) collectEvents() []domain.Event {
+	var events []domain.Event
+	events = append(events, a.UserStorage.CollectEvents()...)
+	events = append(events, a.AttemptStorage.CollectEvents()...)
+	events = append(events, a.ProfileStorage.CollectEvents()...)
+	events = append(events, a.GroupStorage.CollectEvents()...)
+	events = append(events, a.AuditStorage.CollectEvents()...)
+	return events
+}
+
+func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	return &AtomicContext{
+		ctx:            ctx,
+		DBContext:      dbContext,
+		UserStorage:    userstorage.NewPostgresStorage(dbContext, nil),
+		AttemptStorage: attemptstorage.NewPostgresStorage(dbContext),
+		ProfileStorage: profilestorage.NewPostgresStorage(dbContext),
+		GroupStorage:   groupstorage.NewPostgresStorage(dbContext, nil),
+		AuditStorage:   auditstorage.NewPostgresStorage(dbContext),
+	}, nil
+}
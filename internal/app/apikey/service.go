@@ -0,0 +1,168 @@
+package apikeyapp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/apikey"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/google/uuid"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKey = errors.New("api key is invalid")
+)
+
+// KeyPrefix marks API keys so they can be told apart from access tokens.
+const KeyPrefix = "ghk_"
+
+type Service struct {
+	logger *slog.Logger
+}
+
+func New(logger *slog.Logger) *Service {
+	return &Service{
+		logger: logger,
+	}
+}
+
+// IsKey reports whether the bearer credential looks like an API key.
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, KeyPrefix)
+}
+
+// CreateKey issues a key for the user. The returned secret is not stored
+// and cannot be shown again.
+func (s *Service) CreateKey(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userID string,
+	name string,
+	scopes []string,
+) (k *apikey.APIKey, secret string, err error) {
+	prefix, secret := generateKey()
+
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		var err error
+		k, err = apikey.New(uuid.New().String(), userID, name, prefix, hashKey(secret), scopes)
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.KeyStorage.Add(ctx.Context(), k); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+	return
+}
+
+func (s *Service) ListKeys(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userID string,
+) (keys []*apikey.APIKey, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		var err error
+		keys, err = ctx.KeyStorage.ListActiveByUser(ctx.Context(), userID)
+		if err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+func (s *Service) RevokeKey(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userID string,
+	keyID string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		k, err := ctx.KeyStorage.GetByID(ctx.Context(), keyID)
+		if err != nil {
+			return err
+		}
+		if k.UserID != userID {
+			return apikey.ErrKeyNotFound
+		}
+
+		if err := k.Revoke(); err != nil {
+			return err
+		}
+
+		if err := ctx.KeyStorage.Persist(ctx.Context(), k); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+// Authenticate finds the active key by its secret and records its use.
+// Keys of deleted users are rejected.
+func (s *Service) Authenticate(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	secret string,
+) (k *apikey.APIKey, u *auth.User, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		var err error
+		k, err = ctx.KeyStorage.GetBySecretHash(ctx.Context(), hashKey(secret))
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			return ErrInvalidKey
+		}
+		if err != nil {
+			return err
+		}
+
+		u, err = ctx.UserStorage.GetByID(ctx.Context(), k.UserID)
+		if err != nil {
+			return err
+		}
+		if u.DeletedAt != nil || u.IsLocked() {
+			return ErrInvalidKey
+		}
+
+		touched, err := k.Use(time.Now().UTC())
+		if errors.Is(err, apikey.ErrKeyRevoked) {
+			return ErrInvalidKey
+		}
+		if err != nil {
+			return err
+		}
+
+		if touched {
+			if err := ctx.KeyStorage.Persist(ctx.Context(), k); err != nil {
+				return err
+			}
+		}
+
+		return ctx.Commit()
+	})
+	return
+}
+
+func generateKey() (prefix, secret string) {
+	var bytes [32]byte
+	if n, err := rand.Read(bytes[:]); n != len(bytes) || err != nil {
+		panic("failed to generate api key")
+	}
+
+	prefix = KeyPrefix + hex.EncodeToString(bytes[:4])
+	return prefix, prefix + "_" + base64.RawURLEncoding.EncodeToString(bytes[4:])
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
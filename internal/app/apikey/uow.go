@@ -0,0 +1,67 @@
+package apikeyapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	apikeystorage "github.com/burenotti/go_health_backend/internal/adapter/storage/apikeys"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/apikey"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+)
+
+type KeyStorage interface {
+	Add(ctx context.Context, k *apikey.APIKey) error
+	GetByID(ctx context.Context, keyID string) (*apikey.APIKey, error)
+	GetBySecretHash(ctx context.Context, secretHash string) (*apikey.APIKey, error)
+	ListActiveByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error)
+	Persist(ctx context.Context, k *apikey.APIKey) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type UserStorage interface {
+	GetByID(ctx context.Context, userId string) (*auth.User, error)
+}
+
+type AtomicContext struct {
+	ctx context.Context
+	storage.DBContext
+	KeyStorage  KeyStorage
+	UserStorage UserStorage
+}
+
+func (a *AtomicContext) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AtomicContext) Commit() error {
+	return a.DBContext.Commit()
+}
+
+func (a *AtomicContext) Close() (err error) {
+	if closeErr := a.KeyStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		err = errors.Join(fmt.Errorf("failed to close storage"), err)
+	}
+
+	return err
+}
+
+func (a *AtomicContext) CollectEvents() []domain.Event {
+	return a.KeyStorage.CollectEvents()
+}
+
+func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	return &AtomicContext{
+		ctx:         ctx,
+		DBContext:   dbContext,
+		KeyStorage:  apikeystorage.NewPostgresStorage(dbContext),
+		UserStorage: userstorage.NewPostgresStorage(dbContext, nil),
+	}, nil
+}
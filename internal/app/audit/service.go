@@ -0,0 +1,137 @@
+package auditapp
+
+import (
+	"context"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"log/slog"
+	"time"
+)
+
+type Service struct {
+	logger *slog.Logger
+}
+
+func New(logger *slog.Logger) *Service {
+	return &Service{
+		logger: logger,
+	}
+}
+
+// Record appends the entry to the audit log.
+func (s *Service) Record(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	e *audit.Entry,
+) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		if err := ctx.AuditStorage.Add(ctx.Context(), e); err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+}
+
+func (s *Service) ListEntries(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	filter audit.Filter,
+) (entries []*audit.Entry, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		var err error
+		entries, err = ctx.AuditStorage.List(ctx.Context(), filter)
+		if err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+// Writer is the storage RecordEvents writes to.
+type Writer interface {
+	Add(ctx context.Context, e *audit.Entry) error
+}
+
+// RecordEvents writes the entries for the audited events among events.
+// Atomic contexts call it right before committing, so an entry is stored if
+// and only if the change it describes is.
+func RecordEvents(ctx context.Context, w Writer, events []domain.Event) error {
+	for _, event := range events {
+		e := entryFromEvent(event)
+		if e == nil {
+			continue
+		}
+		if err := w.Add(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryFromEvent returns nil for events that aren't audited.
+func entryFromEvent(event domain.Event) *audit.Entry {
+	e := &audit.Entry{
+		Action:    event.Type(),
+		CreatedAt: event.PublishedAt(),
+	}
+
+	// Failed logins, lockouts and reused refresh tokens are caused by whoever
+	// holds the credentials, so no actor is recorded for them.
+	switch ev := event.(type) {
+	case auth.LoginEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"authorization_id": ev.ID}
+		withDevice(e, ev.Device)
+	case auth.LoginFailedEvent:
+		e.UserID = ev.UserID
+		withDevice(e, ev.Device)
+		return e
+	case auth.NewDeviceLoginEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"authorization_id": ev.ID}
+		withDevice(e, ev.Device)
+	case auth.LogoutEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"authorization_id": ev.ID}
+	case auth.RefreshedEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"authorization_id": ev.ID, "session_id": ev.FamilyID}
+		withDevice(e, ev.Device)
+	case auth.RefreshReuseDetectedEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"authorization_id": ev.ID, "session_id": ev.FamilyID}
+		withDevice(e, ev.Device)
+		return e
+	case auth.PasswordChangedEvent:
+		e.UserID = ev.UserID
+	case auth.EmailChangedEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"old_email": ev.OldEmail, "new_email": ev.NewEmail}
+	case auth.EmailChangeRevertedEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"old_email": ev.OldEmail, "new_email": ev.NewEmail}
+	case auth.LockedEvent:
+		e.UserID = ev.UserID
+		e.Details = map[string]string{"until": ev.Until.Format(time.RFC3339)}
+		return e
+	default:
+		return nil
+	}
+
+	e.ActorID = e.UserID
+	return e
+}
+
+func withDevice(e *audit.Entry, dev auth.Device) {
+	e.IPAddress = dev.IPAddress
+	e.Browser = dev.Browser
+	e.OS = dev.OS
+	e.DeviceModel = dev.Model
+}
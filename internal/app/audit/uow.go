@@ -0,0 +1,56 @@
+package auditapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	auditstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/audit"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+)
+
+type AuditStorage interface {
+	Add(ctx context.Context, e *audit.Entry) error
+	List(ctx context.Context, f audit.Filter) ([]*audit.Entry, error)
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AtomicContext struct {
+	ctx context.Context
+	storage.DBContext
+	AuditStorage AuditStorage
+}
+
+func (a *AtomicContext) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AtomicContext) Commit() error {
+	return a.DBContext.Commit()
+}
+
+func (a *AtomicContext) Close() (err error) {
+	if closeErr := a.AuditStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		err = errors.Join(fmt.Errorf("failed to close storage"), err)
+	}
+
+	return err
+}
+
+func (a *AtomicContext) CollectEvents() []domain.Event {
+	return a.AuditStorage.CollectEvents()
+}
+
+func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	return &AtomicContext{
+		ctx:          ctx,
+		DBContext:    dbContext,
+		AuditStorage: auditstorage.NewPostgresStorage(dbContext),
+	}, nil
+}
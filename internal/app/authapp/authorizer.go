@@ -8,7 +8,7 @@ import (
 	"github.com/burenotti/go_health_backend/internal/domain/auth"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"sync"
 	"time"
 )
 
@@ -18,40 +18,106 @@ var (
 )
 
 type Authorizer struct {
-	Cost             int
-	Secret           string
+	Argon2           Argon2Params
+	Keys             *KeySet
 	AccessTokenTTL   time.Duration
 	AuthorizationTTL time.Duration
+	// TOTPSecrets encrypts TOTP secrets at rest.
+	TOTPSecrets *SecretBox
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func (a *Authorizer) Authorize(u *auth.User, password string, dev auth.Device) (*auth.Authorization, error) {
-	hashBytes, err := hex.DecodeString(u.PasswordHash)
+func (a *Authorizer) VerifyPassword(u *auth.User, password string) error {
+	if !u.HasPassword() {
+		a.SimulatePasswordCheck(password)
+		return auth.ErrInvalidCredentials
+	}
+
+	ok, err := verifyHash(u.PasswordHash, password)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if !ok {
+		return auth.ErrInvalidCredentials
 	}
+	return nil
+}
 
-	if err := bcrypt.CompareHashAndPassword(hashBytes, []byte(password)); err != nil {
-		return nil, auth.ErrInvalidCredentials
+// SimulatePasswordCheck verifies the password against a fixed hash, so a
+// login for an unknown account takes as long as one with a wrong password.
+func (a *Authorizer) SimulatePasswordCheck(password string) {
+	a.dummyHashOnce.Do(func() {
+		a.dummyHash = hashArgon2id(a.generateSecret(), a.argon2Params())
+	})
+	_, _ = verifyHash(a.dummyHash, password)
+}
+
+func (a *Authorizer) NeedsRehash(u *auth.User) bool {
+	return u.HasPassword() && needsRehash(u.PasswordHash, a.argon2Params())
+}
+
+func (a *Authorizer) VerifySecondFactor(u *auth.User, code string) error {
+	if u.TOTP == nil {
+		return auth.ErrInvalidSecondFactor
+	}
+
+	secret, err := a.TOTPSecrets.Open(u.TOTP.Secret)
+	if err != nil {
+		return err
 	}
 
+	code = normalizeCode(code)
+	if step, ok := matchTOTP(secret, code, time.Now()); ok {
+		if !u.TOTP.AcceptStep(step) {
+			return auth.ErrInvalidSecondFactor
+		}
+		return nil
+	}
+
+	if u.TOTP.UseRecoveryCode(hashToken(code)) {
+		return nil
+	}
+	return auth.ErrInvalidSecondFactor
+}
+
+func (a *Authorizer) Issue(dev auth.Device) *auth.Authorization {
 	now := time.Now().UTC()
-	authorization := &auth.Authorization{
-		ID:         uuid.New().String(),
+	id := uuid.New().String()
+	return &auth.Authorization{
+		ID:         id,
+		FamilyID:   id,
 		Secret:     a.generateSecret(),
 		CreatedAt:  now,
 		ValidUntil: now.Add(a.AuthorizationTTL),
 		LogoutAt:   nil,
 		Device:     dev,
 	}
-	return authorization, nil
+}
+
+func (a *Authorizer) Renew(prev *auth.Authorization) *auth.Authorization {
+	now := time.Now().UTC()
+	return &auth.Authorization{
+		ID:         uuid.New().String(),
+		FamilyID:   prev.FamilyID,
+		Secret:     a.generateSecret(),
+		CreatedAt:  now,
+		ValidUntil: now.Add(a.AuthorizationTTL),
+		LogoutAt:   nil,
+		Device:     prev.Device,
+	}
 }
 
 func (a *Authorizer) Hash(password string) string {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.Cost)
-	if err != nil {
-		panic(err)
+	return hashArgon2id(password, a.argon2Params())
+}
+
+func (a *Authorizer) argon2Params() Argon2Params {
+	if a.Argon2 == (Argon2Params{}) {
+		return DefaultArgon2Params
 	}
-	return hex.EncodeToString(hash)
+	return a.Argon2
 }
 
 func (a *Authorizer) generateSecret() string {
@@ -63,27 +129,51 @@ func (a *Authorizer) generateSecret() string {
 	return hex.EncodeToString(bytes[:])
 }
 
-func (a *Authorizer) GenerateAccessToken(u *auth.User, auth *auth.Authorization) (string, error) {
+type TokenOption func(claims jwt.MapClaims)
+
+// ActingAs issues the token to actorID acting on behalf of the subject. The
+// token expires at the given moment instead of after AccessTokenTTL.
+func ActingAs(actorID string, expiresAt time.Time) TokenOption {
+	return func(claims jwt.MapClaims) {
+		claims["act"] = map[string]any{"sub": actorID}
+		claims["exp"] = expiresAt.Unix()
+	}
+}
+
+func (a *Authorizer) GenerateAccessToken(u *auth.User, auth *auth.Authorization, opts ...TokenOption) (string, error) {
 	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"jti": auth.ID,
-		"sub": u.UserID,
-		"exp": now.Add(a.AccessTokenTTL).Unix(),
-		"iat": now.Unix(),
-	})
-	return token.SignedString([]byte(a.Secret))
+	claims := jwt.MapClaims{
+		"jti":            auth.ID,
+		"sub":            u.UserID,
+		"exp":            now.Add(a.AccessTokenTTL).Unix(),
+		"iat":            now.Unix(),
+		"email_verified": u.IsVerified(),
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+	return a.Keys.Sign(claims)
 }
 
 type AccessTokenData struct {
 	Authorization string
 	UserID        string
+	EmailVerified bool
+	// APIKey is set instead of Authorization when the request was made with
+	// an API key.
+	APIKey string
+	// ActorID is the administrator impersonating the user. Authorization
+	// then belongs to the session of the administrator.
+	ActorID string
+}
+
+func (d *AccessTokenData) IsImpersonated() bool {
+	return d.ActorID != ""
 }
 
 func (a *Authorizer) ValidateAccessToken(accessToken string) (*AccessTokenData, error) {
 	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(accessToken, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(a.Secret), nil
-	})
+	_, err := jwt.ParseWithClaims(accessToken, &claims, a.Keys.Keyfunc)
 
 	if err != nil /* && err.(*jwt.ValidationError).Errors != jwt.ValidationErrorExpired */ {
 		return nil, ErrAccessTokenInvalid
@@ -93,9 +183,32 @@ func (a *Authorizer) ValidateAccessToken(accessToken string) (*AccessTokenData,
 	//	return nil, ErrAccessTokenExpired
 	//}
 
+	// Link tokens are never access tokens, whatever key they are signed with.
+	if _, ok := claims["purpose"]; ok {
+		return nil, ErrAccessTokenInvalid
+	}
+
+	authorization, _ := claims["jti"].(string)
+	userId, _ := claims["sub"].(string)
+	if authorization == "" || userId == "" {
+		return nil, ErrAccessTokenInvalid
+	}
+
+	var actorId string
+	if act, ok := claims["act"]; ok {
+		actor, _ := act.(map[string]any)
+		actorId, _ = actor["sub"].(string)
+		if actorId == "" {
+			return nil, ErrAccessTokenInvalid
+		}
+	}
+
+	emailVerified, _ := claims["email_verified"].(bool)
 	data := &AccessTokenData{
-		Authorization: claims["jti"].(string),
-		UserID:        claims["sub"].(string),
+		Authorization: authorization,
+		UserID:        userId,
+		EmailVerified: emailVerified,
+		ActorID:       actorId,
 	}
-	return data, err
+	return data, nil
 }
@@ -0,0 +1,161 @@
+package authapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// RequestEmailChange mails a confirmation link to the new address and an
+// undo link to the current one.
+func (s *Service) RequestEmailChange(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	authId string,
+	r auth.Reauthentication,
+	newEmail string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		if err := s.checkEmailAvailable(ctx, u.UserID, newEmail); err != nil {
+			return err
+		}
+
+		c, err := u.RequestEmailChange(
+			s.Authorizer,
+			uuid.New().String(),
+			authId,
+			r,
+			newEmail,
+			s.emailChangeTTL,
+			s.emailChangeUndoTTL,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.EmailChangeStorage.Add(ctx.Context(), c); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+// EmailChangeTokens signs the confirmation and undo tokens mailed for the
+// change.
+func (s *Service) EmailChangeTokens(
+	changeId string,
+	userId string,
+	expiresAt time.Time,
+	undoUntil time.Time,
+) (confirm string, undo string, err error) {
+	confirm, err = s.links.Sign(PurposeConfirmEmailChange, userId, time.Until(expiresAt), jwt.MapClaims{
+		"jti": changeId,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	undo, err = s.links.Sign(PurposeRevertEmailChange, userId, time.Until(undoUntil), jwt.MapClaims{
+		"jti": changeId,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return confirm, undo, nil
+}
+
+func (s *Service) ConfirmEmailChange(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	token string,
+) error {
+	return s.applyEmailChange(ctx, uow, PurposeConfirmEmailChange, token, func(ctx *AtomicContext, u *auth.User, c *auth.EmailChange) error {
+		if err := s.checkEmailAvailable(ctx, u.UserID, c.NewEmail); err != nil {
+			return err
+		}
+		return u.ConfirmEmailChange(c)
+	})
+}
+
+func (s *Service) RevertEmailChange(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	token string,
+) error {
+	return s.applyEmailChange(ctx, uow, PurposeRevertEmailChange, token, func(ctx *AtomicContext, u *auth.User, c *auth.EmailChange) error {
+		if c.ConfirmedAt != nil {
+			if err := s.checkEmailAvailable(ctx, u.UserID, c.OldEmail); err != nil {
+				return err
+			}
+		}
+		return u.RevertEmailChange(c)
+	})
+}
+
+func (s *Service) applyEmailChange(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	purpose string,
+	token string,
+	apply func(ctx *AtomicContext, u *auth.User, c *auth.EmailChange) error,
+) error {
+	claims, err := s.links.Verify(purpose, token)
+	if err != nil {
+		return auth.ErrEmailChangeInvalid
+	}
+	userId, _ := claims["sub"].(string)
+	changeId, _ := claims["jti"].(string)
+
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		c, err := ctx.EmailChangeStorage.GetByID(ctx.Context(), changeId)
+		if err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return auth.ErrEmailChangeInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := apply(ctx, u, c); err != nil {
+			return err
+		}
+
+		if err := ctx.EmailChangeStorage.Persist(ctx.Context(), c); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+func (s *Service) checkEmailAvailable(ctx *AtomicContext, userId string, email string) error {
+	other, err := ctx.UserStorage.GetByEmail(ctx.Context(), email)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.UserID != userId {
+		return auth.ErrUserEmailDuplicate
+	}
+	return nil
+}
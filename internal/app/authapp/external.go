@@ -0,0 +1,244 @@
+package authapp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrUnknownProvider      = errors.New("unknown identity provider")
+	ErrExternalLoginInvalid = errors.New("external login is invalid or expired")
+	ErrExternalEmailMissing = errors.New("identity provider did not return a verified email")
+	// ErrExternalEmailTaken is returned when an unverified local account uses
+	// the email. Linking it would let whoever registered it keep access.
+	ErrExternalEmailTaken = errors.New("email is used by an unverified account")
+)
+
+// IdentityProvider runs the authorization code flow with PKCE against an
+// OpenID Connect provider.
+type IdentityProvider interface {
+	// AuthCodeURL returns the address the user is redirected to. With reauth
+	// set the provider is asked to authenticate the user again even if there
+	// is a session at the provider.
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string, reauth bool) (string, error)
+	// Exchange redeems the code and returns the claims of the validated ID
+	// token.
+	Exchange(ctx context.Context, code, verifier, nonce string) (*IdentityClaims, error)
+}
+
+type IdentityClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// AuthTime is when the provider last authenticated the user. It is zero
+	// if the provider didn't tell.
+	AuthTime time.Time
+}
+
+type ExternalLogin struct {
+	RedirectURL string
+	// StateToken carries the state, nonce and PKCE verifier to the callback.
+	// It must be kept by the client, e.g. in a cookie.
+	StateToken string
+}
+
+// StartExternalLogin prepares the redirect to the identity provider.
+func (s *Service) StartExternalLogin(ctx context.Context, provider string) (ExternalLogin, error) {
+	return s.startExternalLogin(ctx, provider, "")
+}
+
+// StartReauthentication prepares the redirect for a user without a password
+// who has to log in at the provider again before a sensitive change. The
+// callback then returns a reauthentication token instead of a session.
+func (s *Service) StartReauthentication(ctx context.Context, userId, provider string) (ExternalLogin, error) {
+	return s.startExternalLogin(ctx, provider, userId)
+}
+
+func (s *Service) startExternalLogin(ctx context.Context, provider, reauthUserId string) (ExternalLogin, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return ExternalLogin{}, ErrUnknownProvider
+	}
+
+	state, _ := newToken()
+	nonce, _ := newToken()
+	verifier, _ := newToken()
+
+	redirectURL, err := p.AuthCodeURL(ctx, state, nonce, verifier, reauthUserId != "")
+	if err != nil {
+		return ExternalLogin{}, err
+	}
+
+	claims := jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+	}
+	if reauthUserId != "" {
+		claims["reauth"] = reauthUserId
+	}
+	stateToken, err := s.links.Sign(PurposeExternalAuth, provider, s.externalStateTTL, claims)
+	if err != nil {
+		return ExternalLogin{}, err
+	}
+
+	return ExternalLogin{
+		RedirectURL: redirectURL,
+		StateToken:  stateToken,
+	}, nil
+}
+
+// CompleteExternalLogin redeems the authorization code returned to the
+// callback. The identity is looked up by the provider subject; an unknown
+// one is linked to the user with the same verified email or a new user is
+// created.
+func (s *Service) CompleteExternalLogin(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	device auth.Device,
+	provider string,
+	code string,
+	state string,
+	stateToken string,
+) (res LoginResult, err error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return LoginResult{}, ErrUnknownProvider
+	}
+
+	claims, err := s.links.Verify(PurposeExternalAuth, stateToken)
+	if err != nil {
+		return LoginResult{}, ErrExternalLoginInvalid
+	}
+
+	expectedState, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	if claims["sub"] != provider || subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
+		return LoginResult{}, ErrExternalLoginInvalid
+	}
+
+	identity, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if userId, _ := claims["reauth"].(string); userId != "" {
+		res.ReauthToken, err = s.reauthenticationToken(ctx, uow, userId, provider, identity)
+		return
+	}
+
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := s.externalUser(ctx, provider, identity)
+		if err != nil {
+			return err
+		}
+
+		a, err := u.AuthorizeExternal(s.Authorizer, provider, identity.Subject, device)
+		if errors.Is(err, auth.ErrSecondFactorRequired) {
+			if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+				return err
+			}
+			res.MFAToken, err = s.newSecondFactorChallenge(ctx, u.UserID)
+			if err != nil {
+				return err
+			}
+			return ctx.Commit()
+		}
+		if err != nil {
+			return err
+		}
+
+		res.Tokens, err = s.issueTokens(ctx, u, a)
+		return err
+	})
+	return
+}
+
+func (s *Service) reauthenticationToken(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	provider string,
+	identity *IdentityClaims,
+) (token string, err error) {
+	if time.Since(identity.AuthTime) > auth.ReauthenticationMaxAge {
+		return "", auth.ErrReauthenticationRequired
+	}
+
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+		if u.GetIdentity(provider, identity.Subject) == nil {
+			return auth.ErrIdentityNotLinked
+		}
+
+		token, err = s.links.Sign(PurposeReauthenticate, userId, auth.ReauthenticationMaxAge, jwt.MapClaims{
+			"provider":  provider,
+			"idp_sub":   identity.Subject,
+			"auth_time": identity.AuthTime.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+// Reauthentication returns the proof of presence the user sent with a
+// sensitive request: the password or a token from StartReauthentication.
+func (s *Service) Reauthentication(userId, password, reauthToken string) (auth.Reauthentication, error) {
+	if reauthToken == "" {
+		return auth.Reauthentication{Password: password}, nil
+	}
+
+	claims, err := s.links.Verify(PurposeReauthenticate, reauthToken)
+	if err != nil || claims["sub"] != userId {
+		return auth.Reauthentication{}, auth.ErrReauthenticationRequired
+	}
+
+	r := auth.Reauthentication{Password: password}
+	r.Provider, _ = claims["provider"].(string)
+	r.Subject, _ = claims["idp_sub"].(string)
+	authTime, _ := claims["auth_time"].(float64)
+	r.AuthTime = time.Unix(int64(authTime), 0)
+	return r, nil
+}
+
+func (s *Service) externalUser(ctx *AtomicContext, provider string, identity *IdentityClaims) (*auth.User, error) {
+	u, err := ctx.UserStorage.GetByIdentity(ctx.Context(), provider, identity.Subject)
+	if err == nil || !errors.Is(err, auth.ErrUserNotFound) {
+		return u, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrExternalEmailMissing
+	}
+
+	u, err = ctx.UserStorage.GetByEmail(ctx.Context(), identity.Email)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		u = auth.NewExternalUser(uuid.New().String(), identity.Email, provider, identity.Subject)
+		return u, ctx.UserStorage.Add(ctx.Context(), u)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.IsVerified() {
+		return nil, ErrExternalEmailTaken
+	}
+
+	if err := u.LinkIdentity(provider, identity.Subject, identity.Email); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
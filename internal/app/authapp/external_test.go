@@ -0,0 +1,121 @@
+package authapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type stubProvider struct {
+	reauth    bool
+	exchanged bool
+}
+
+func (p *stubProvider) AuthCodeURL(_ context.Context, state, nonce, verifier string, reauth bool) (string, error) {
+	p.reauth = reauth
+	q := url.Values{"state": {state}, "nonce": {nonce}, "code_challenge": {verifier}}
+	return "https://idp.example/authorize?" + q.Encode(), nil
+}
+
+func (p *stubProvider) Exchange(context.Context, string, string, string) (*IdentityClaims, error) {
+	p.exchanged = true
+	return nil, errors.New("unexpected exchange")
+}
+
+func newExternalTestService(providers map[string]IdentityProvider) *Service {
+	return NewService(
+		&Authorizer{},
+		&LinkSigner{Secret: []byte("link-secret")},
+		slog.Default(),
+		ExternalProviders(providers, time.Minute),
+	)
+}
+
+func stateOf(t *testing.T, login ExternalLogin) string {
+	u, err := url.Parse(login.RedirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestCompleteExternalLoginRejectsInvalidState(t *testing.T) {
+	first, second := &stubProvider{}, &stubProvider{}
+	s := newExternalTestService(map[string]IdentityProvider{"first": first, "second": second})
+	ctx := context.Background()
+
+	login, err := s.StartExternalLogin(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := stateOf(t, login)
+
+	tests := []struct {
+		name       string
+		provider   string
+		state      string
+		stateToken string
+	}{
+		{name: "state mismatch", provider: "first", state: "forged", stateToken: login.StateToken},
+		{name: "empty state", provider: "first", state: "", stateToken: login.StateToken},
+		{name: "token of another provider", provider: "second", state: state, stateToken: login.StateToken},
+		{name: "tampered token", provider: "first", state: state, stateToken: login.StateToken + "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CompleteExternalLogin(ctx, nil, auth.Device{}, tt.provider, "code", tt.state, tt.stateToken)
+			if !errors.Is(err, ErrExternalLoginInvalid) {
+				t.Fatalf("error = %v, want %v", err, ErrExternalLoginInvalid)
+			}
+			if first.exchanged || second.exchanged {
+				t.Fatal("code must not be exchanged")
+			}
+		})
+	}
+}
+
+func TestStartReauthenticationForcesLogin(t *testing.T) {
+	p := &stubProvider{}
+	s := newExternalTestService(map[string]IdentityProvider{"idp": p})
+
+	if _, err := s.StartExternalLogin(context.Background(), "idp"); err != nil || p.reauth {
+		t.Fatalf("login: err = %v, reauth = %v", err, p.reauth)
+	}
+	if _, err := s.StartReauthentication(context.Background(), "user-1", "idp"); err != nil || !p.reauth {
+		t.Fatalf("reauthentication: err = %v, reauth = %v", err, p.reauth)
+	}
+}
+
+func TestReauthentication(t *testing.T) {
+	s := newExternalTestService(nil)
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	token, err := s.links.Sign(PurposeReauthenticate, "user-1", time.Minute, map[string]any{
+		"provider":  "idp",
+		"idp_sub":   "subject-1",
+		"auth_time": authTime.Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Reauthentication("user-1", "", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Provider != "idp" || r.Subject != "subject-1" || !r.AuthTime.Equal(authTime) {
+		t.Errorf("unexpected reauthentication %+v", r)
+	}
+
+	if _, err := s.Reauthentication("user-2", "", token); !errors.Is(err, auth.ErrReauthenticationRequired) {
+		t.Errorf("token of another user: error = %v", err)
+	}
+
+	magic, _ := s.links.Sign(PurposeMagicLink, "user-1", time.Minute, nil)
+	if _, err := s.Reauthentication("user-1", "", magic); !errors.Is(err, auth.ErrReauthenticationRequired) {
+		t.Errorf("token for another purpose: error = %v", err)
+	}
+}
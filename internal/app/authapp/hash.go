@@ -0,0 +1,127 @@
+package authapp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+const algorithmArgon2id = "argon2id"
+
+// Argon2Params are the argon2id settings new hashes are made with. Memory is
+// in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// argon2Hash is an argon2id hash in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type argon2Hash struct {
+	params Argon2Params
+	salt   []byte
+	key    []byte
+}
+
+func hashArgon2id(password string, p Argon2Params) string {
+	salt := make([]byte, p.SaltLength)
+	if n, err := rand.Read(salt); n != len(salt) || err != nil {
+		panic("failed to generate salt")
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		algorithmArgon2id,
+		argon2.Version,
+		p.Memory,
+		p.Iterations,
+		p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func parseArgon2id(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != algorithmArgon2id {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownHashFormat
+	}
+
+	h := &argon2Hash{}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Iterations, &h.params.Parallelism)
+	if err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+
+	h.params.SaltLength = uint32(len(h.salt))
+	h.params.KeyLength = uint32(len(h.key))
+	return h, nil
+}
+
+func (h *argon2Hash) verify(password string) bool {
+	p := h.params
+	key := argon2.IDKey([]byte(password), h.salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// verifyHash checks the password against an argon2id PHC string or, for
+// accounts created before it was introduced, a hex encoded bcrypt hash.
+func verifyHash(encoded, password string) (bool, error) {
+	if strings.HasPrefix(encoded, "$"+algorithmArgon2id+"$") {
+		h, err := parseArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		return h.verify(password), nil
+	}
+
+	legacy, err := hex.DecodeString(encoded)
+	if err != nil || len(legacy) == 0 {
+		return false, ErrUnknownHashFormat
+	}
+	return bcrypt.CompareHashAndPassword(legacy, []byte(password)) == nil, nil
+}
+
+// needsRehash reports whether the hash was made with another algorithm or
+// other parameters than the current ones.
+func needsRehash(encoded string, p Argon2Params) bool {
+	h, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return h.params != p
+}
@@ -0,0 +1,199 @@
+package authapp
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"os"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid signing key")
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    any
+}
+
+// KeySet holds the key access tokens are signed with and every key they are
+// still accepted with. Keeping the previous public keys in the set lets
+// tokens signed before a rotation stay valid until they expire.
+type KeySet struct {
+	method       jwt.SigningMethod
+	keyID        string
+	signingKey   any
+	verification map[string]verificationKey
+}
+
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		verification: map[string]verificationKey{
+			"": {method: jwt.SigningMethodHS256, key: []byte(secret)},
+		},
+	}
+}
+
+// LoadKeySet reads the PEM encoded private key for the algorithm and the
+// public keys of previous generations. With acceptLegacyHMAC tokens signed
+// with the shared secret stay valid while switching to asymmetric keys.
+func LoadKeySet(
+	algorithm string,
+	keyID string,
+	privateKeyFile string,
+	verificationKeyFiles map[string]string,
+	hmacSecret string,
+	acceptLegacyHMAC bool,
+) (*KeySet, error) {
+	if algorithm == AlgorithmHS256 {
+		if hmacSecret == "" {
+			return nil, fmt.Errorf("%w: secret is required for %s", ErrInvalidKey, algorithm)
+		}
+		return NewHMACKeySet(hmacSecret), nil
+	}
+
+	if keyID == "" {
+		return nil, fmt.Errorf("%w: key id is required for %s", ErrInvalidKey, algorithm)
+	}
+
+	pem, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	k := &KeySet{
+		keyID:        keyID,
+		verification: make(map[string]verificationKey),
+	}
+
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		k.method = jwt.SigningMethodRS256
+		k.signingKey = key
+		k.verification[keyID] = verificationKey{method: k.method, key: &key.PublicKey}
+	case AlgorithmEdDSA:
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		k.method = jwt.SigningMethodEdDSA
+		k.signingKey = key
+		k.verification[keyID] = verificationKey{
+			method: k.method,
+			key:    key.(crypto.Signer).Public().(ed25519.PublicKey),
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidKey, algorithm)
+	}
+
+	for kid, file := range verificationKeyFiles {
+		if kid == keyID {
+			continue
+		}
+		key, err := loadPublicKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidKey, kid, err)
+		}
+		k.verification[kid] = key
+	}
+
+	if acceptLegacyHMAC {
+		if hmacSecret == "" {
+			return nil, fmt.Errorf("%w: secret is required to accept legacy tokens", ErrInvalidKey)
+		}
+		k.verification[""] = verificationKey{method: jwt.SigningMethodHS256, key: []byte(hmacSecret)}
+	}
+
+	return k, nil
+}
+
+func loadPublicKey(file string) (verificationKey, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return verificationKey{}, err
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return verificationKey{method: jwt.SigningMethodRS256, key: key}, nil
+	}
+
+	key, err := jwt.ParseEdPublicKeyFromPEM(pem)
+	if err != nil {
+		return verificationKey{}, errors.New("only RSA and Ed25519 public keys are supported")
+	}
+	return verificationKey{method: jwt.SigningMethodEdDSA, key: key.(ed25519.PublicKey)}, nil
+}
+
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.keyID != "" {
+		token.Header["kid"] = k.keyID
+	}
+	return token.SignedString(k.signingKey)
+}
+
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidKey, kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("%w: unexpected signing method %s", ErrInvalidKey, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+type JWK struct {
+	KeyType   string
+	KeyID     string
+	Algorithm string
+	Curve     string
+	N         string
+	E         string
+	X         string
+}
+
+// PublicKeys returns the asymmetric verification keys in the JWK format.
+func (k *KeySet) PublicKeys() []JWK {
+	keys := make([]JWK, 0, len(k.verification))
+	for kid, key := range k.verification {
+		switch pub := key.key.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     kid,
+				Algorithm: AlgorithmRS256,
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     kid,
+				Algorithm: AlgorithmEdDSA,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,66 @@
+package authapp
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"time"
+)
+
+var (
+	ErrLinkInvalid = errors.New("link is invalid or expired")
+)
+
+const (
+	PurposeVerifyEmail    = "verify_email"
+	PurposeSecondFactor   = "second_factor"
+	PurposeDataExport     = "data_export"
+	PurposeExternalAuth   = "external_auth"
+	PurposeMagicLink      = "magic_link"
+	PurposeReauthenticate = "reauthenticate"
+
+	PurposeConfirmEmailChange = "confirm_email_change"
+	PurposeRevertEmailChange  = "revert_email_change"
+)
+
+// LinkSigner signs the short-lived tokens embedded into links sent to users.
+// The purpose claim keeps a token issued for one flow from being accepted
+// by another.
+type LinkSigner struct {
+	Secret []byte
+}
+
+func (s *LinkSigner) Sign(purpose, subject string, ttl time.Duration, claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	c := jwt.MapClaims{}
+	for k, v := range claims {
+		c[k] = v
+	}
+	c["purpose"] = purpose
+	c["sub"] = subject
+	c["iat"] = now.Unix()
+	c["exp"] = now.Add(ttl).Unix()
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(s.Secret)
+}
+
+func (s *LinkSigner) Verify(purpose, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, ErrLinkInvalid
+		}
+		return s.Secret, nil
+	})
+	if err != nil {
+		return nil, ErrLinkInvalid
+	}
+
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return nil, ErrLinkInvalid
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, ErrLinkInvalid
+	}
+	return claims, nil
+}
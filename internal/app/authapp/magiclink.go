@@ -0,0 +1,177 @@
+package authapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// RequestMagicLink mails a passwordless login link bound to the browser
+// keeping the returned nonce. Unknown emails are silently ignored, like in
+// RequestPasswordReset.
+//
+// Every request counts against the client address and the email, so the
+// endpoint can't be used to flood mailboxes. The counters are separate from
+// the login lockout ones.
+func (s *Service) RequestMagicLink(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	device auth.Device,
+	email string,
+) (nonce string, err error) {
+	nonce, nonceHash := newToken()
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		now := time.Now().UTC()
+
+		address, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeLinkAddress, device.IPAddress)
+		if err != nil {
+			return err
+		}
+		if err := address.Check(now); err != nil {
+			return err
+		}
+
+		mailbox, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeEmail, strings.ToLower(email))
+		if err != nil {
+			return err
+		}
+		if err := mailbox.Check(now); err != nil {
+			return err
+		}
+
+		if err := s.countAttempts(ctx, now, address, mailbox); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByEmail(ctx.Context(), email)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				return ctx.Commit()
+			}
+			return err
+		}
+		if u.DeletedAt != nil {
+			return ctx.Commit()
+		}
+
+		linkId := uuid.New().String()
+		token, err := s.links.Sign(PurposeMagicLink, u.UserID, s.magicLinkTTL, jwt.MapClaims{"jti": linkId})
+		if err != nil {
+			return err
+		}
+
+		l := auth.NewMagicLink(linkId, u, device, nonceHash, token, s.magicLinkTTL)
+		if err := ctx.MagicLinkStorage.Add(ctx.Context(), l); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+	if err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// CompleteMagicLink exchanges the token from the link for a session, or for
+// a second factor challenge when it is enabled. The nonce must be the one
+// RequestMagicLink returned to the browser.
+//
+// Invalid links count as failed logins of the client address and, once the
+// user is known, of the account.
+func (s *Service) CompleteMagicLink(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	device auth.Device,
+	token string,
+	nonce string,
+) (res LoginResult, err error) {
+	claims, verifyErr := s.links.Verify(PurposeMagicLink, token)
+	userId, _ := claims["sub"].(string)
+	linkId, _ := claims["jti"].(string)
+
+	var linkErr error
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		now := time.Now().UTC()
+
+		address, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAddress, device.IPAddress)
+		if err != nil {
+			return err
+		}
+		if err := address.Check(now); err != nil {
+			return err
+		}
+
+		if verifyErr != nil {
+			linkErr = auth.ErrMagicLinkInvalid
+			return s.registerFailure(ctx, now, address)
+		}
+
+		l, err := ctx.MagicLinkStorage.GetByID(ctx.Context(), linkId)
+		if errors.Is(err, auth.ErrMagicLinkInvalid) {
+			linkErr = err
+			return s.registerFailure(ctx, now, address)
+		}
+		if err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			linkErr = auth.ErrMagicLinkInvalid
+			return s.registerFailure(ctx, now, address)
+		}
+		if err != nil {
+			return err
+		}
+
+		account, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAccount, u.UserID)
+		if err != nil {
+			return err
+		}
+		if err := account.Check(now); err != nil {
+			return err
+		}
+
+		a, err := u.AuthorizeMagicLink(s.Authorizer, l, hashToken(nonce), device)
+		if errors.Is(err, auth.ErrMagicLinkInvalid) {
+			linkErr = err
+			return s.registerFailure(ctx, now, address, account)
+		}
+		if err != nil && !errors.Is(err, auth.ErrSecondFactorRequired) {
+			return err
+		}
+
+		if err := ctx.MagicLinkStorage.Persist(ctx.Context(), l); err != nil {
+			return err
+		}
+
+		account.Reset()
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), account); err != nil {
+			return err
+		}
+
+		if a == nil {
+			if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+				return err
+			}
+			res.MFAToken, err = s.newSecondFactorChallenge(ctx, u.UserID)
+			if err != nil {
+				return err
+			}
+			return ctx.Commit()
+		}
+
+		res.Tokens, err = s.issueTokens(ctx, u, a)
+		return err
+	})
+	if err == nil {
+		err = linkErr
+	}
+	return
+}
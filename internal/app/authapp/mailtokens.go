@@ -0,0 +1,18 @@
+package authapp
+
+import (
+	"context"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+)
+
+// MailTokens hands out the tokens the notifier mails. The ones stored by
+// hash are issued in their own unit of work, so they never travel with
+// events.
+type MailTokens struct {
+	*Service
+	UoW *unitofwork.UnitOfWork[*AtomicContext]
+}
+
+func (t MailTokens) PasswordResetToken(ctx context.Context, resetId string) (string, error) {
+	return t.IssuePasswordResetToken(ctx, t.UoW, resetId)
+}
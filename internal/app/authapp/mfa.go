@@ -0,0 +1,252 @@
+package authapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const recoveryCodesCount = 10
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// newSecondFactorChallenge stores a challenge for the user and returns the
+// token referencing it.
+func (s *Service) newSecondFactorChallenge(ctx *AtomicContext, userId string) (string, error) {
+	c := auth.NewSecondFactorChallenge(uuid.New().String(), userId, s.mfaChallengeTTL)
+	if err := ctx.ChallengeStorage.Add(ctx.Context(), c); err != nil {
+		return "", err
+	}
+	return s.links.Sign(PurposeSecondFactor, userId, s.mfaChallengeTTL, jwt.MapClaims{"jti": c.ChallengeID})
+}
+
+// CompleteSecondFactor finishes the login started with the challenge token.
+// The token is accepted only once; wrong codes are counted on the challenge,
+// the account and the client address like failed logins.
+func (s *Service) CompleteSecondFactor(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	device auth.Device,
+	mfaToken string,
+	code string,
+) (tokens Tokens, err error) {
+	claims, err := s.links.Verify(PurposeSecondFactor, mfaToken)
+	if err != nil {
+		return Tokens{}, errors.Join(err, auth.ErrInvalidCredentials)
+	}
+	userId, _ := claims["sub"].(string)
+	challengeId, _ := claims["jti"].(string)
+	if challengeId == "" {
+		return Tokens{}, errors.Join(ErrLinkInvalid, auth.ErrInvalidCredentials)
+	}
+
+	var codeErr error
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		now := time.Now().UTC()
+
+		address, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAddress, device.IPAddress)
+		if err != nil {
+			return err
+		}
+		if err := address.Check(now); err != nil {
+			return err
+		}
+
+		challenge, err := ctx.ChallengeStorage.GetByID(ctx.Context(), challengeId)
+		if err != nil {
+			return err
+		}
+		if challenge.UserID != userId {
+			return auth.ErrChallengeInvalid
+		}
+		if err := challenge.Check(now); err != nil {
+			return err
+		}
+
+		account, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAccount, userId)
+		if err != nil {
+			return err
+		}
+		if err := account.Check(now); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		a, err := u.AuthorizeSecondFactor(s.Authorizer, code, device)
+		if errors.Is(err, auth.ErrInvalidSecondFactor) {
+			codeErr = err
+			challenge.Fail()
+			if err := ctx.ChallengeStorage.Persist(ctx.Context(), challenge); err != nil {
+				return err
+			}
+			return s.registerFailure(ctx, now, address, account)
+		}
+		if err != nil {
+			return err
+		}
+
+		challenge.Use(now)
+		if err := ctx.ChallengeStorage.Persist(ctx.Context(), challenge); err != nil {
+			return err
+		}
+
+		account.Reset()
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), account); err != nil {
+			return err
+		}
+
+		tokens, err = s.issueTokens(ctx, u, a)
+		return err
+	})
+	if err == nil {
+		err = codeErr
+	}
+	return
+}
+
+func (s *Service) EnrollTOTP(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+) (enrollment TOTPEnrollment, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		secret := generateTOTPSecret()
+		if err := u.EnrollTOTP(s.Authorizer.TOTPSecrets.Seal(secret)); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		enrollment = TOTPEnrollment{
+			Secret: secret,
+			URI:    totpURI(s.mfaIssuer, u.Email, secret),
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+// ConfirmTOTP enables the enrolled secret and returns recovery codes.
+// The codes are only stored hashed, so they can't be shown again. Wrong codes
+// count as failed logins of the account.
+func (s *Service) ConfirmTOTP(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	code string,
+) (recoveryCodes []string, err error) {
+	var codeErr error
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		now := time.Now().UTC()
+
+		account, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAccount, userId)
+		if err != nil {
+			return err
+		}
+		if err := account.Check(now); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		codes, hashes := generateRecoveryCodes(recoveryCodesCount)
+		err = u.ConfirmTOTP(s.Authorizer, code, hashes)
+		if errors.Is(err, auth.ErrInvalidSecondFactor) {
+			codeErr = err
+			return s.registerFailure(ctx, now, account)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		account.Reset()
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), account); err != nil {
+			return err
+		}
+
+		recoveryCodes = codes
+		return ctx.Commit()
+	})
+	if err == nil {
+		err = codeErr
+	}
+	return
+}
+
+// DisableTOTP removes the second factor. Besides a code it takes the proof
+// of presence of sensitive changes. Wrong codes and passwords count as failed
+// logins of the account.
+func (s *Service) DisableTOTP(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	r auth.Reauthentication,
+	code string,
+) error {
+	var codeErr error
+	err := uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		now := time.Now().UTC()
+
+		account, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAccount, userId)
+		if err != nil {
+			return err
+		}
+		if err := account.Check(now); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		err = u.DisableTOTP(s.Authorizer, r, code)
+		if errors.Is(err, auth.ErrInvalidSecondFactor) || errors.Is(err, auth.ErrInvalidCredentials) {
+			codeErr = err
+			return s.registerFailure(ctx, now, account)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		account.Reset()
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), account); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+	if err == nil {
+		err = codeErr
+	}
+	return err
+}
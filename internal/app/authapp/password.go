@@ -0,0 +1,149 @@
+package authapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/google/uuid"
+	"time"
+)
+
+// RequestPasswordReset issues a reset for the account and invalidates the
+// ones requested before. Unknown emails are silently ignored, so the endpoint
+// can't be used to probe for accounts.
+func (s *Service) RequestPasswordReset(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	email string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByEmail(ctx.Context(), email)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				return ctx.Commit()
+			}
+			return err
+		}
+
+		if err := ctx.ResetStorage.ExpireOutstanding(ctx.Context(), u.UserID, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		r := auth.NewPasswordReset(uuid.New().String(), u, s.passwordResetTTL)
+		if err := ctx.ResetStorage.Add(ctx.Context(), r); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+// IssuePasswordResetToken generates the token mailed for the reset. Only its
+// hash is stored.
+func (s *Service) IssuePasswordResetToken(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	resetId string,
+) (token string, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		r, err := ctx.ResetStorage.GetByID(ctx.Context(), resetId)
+		if err != nil {
+			return err
+		}
+
+		var hash string
+		token, hash = newToken()
+		if err := r.IssueToken(hash); err != nil {
+			return err
+		}
+
+		if err := ctx.ResetStorage.Persist(ctx.Context(), r); err != nil {
+			return err
+		}
+		return ctx.Commit()
+	})
+	return
+}
+
+func (s *Service) ResetPassword(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	token string,
+	password string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		r, err := ctx.ResetStorage.GetByTokenHash(ctx.Context(), hashToken(token))
+		if err != nil {
+			return err
+		}
+
+		if err := r.Use(); err != nil {
+			return err
+		}
+
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), r.UserID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.passwordPolicy.Validate(password, u.Email); err != nil {
+			return err
+		}
+
+		u.ResetPassword(s.Authorizer, password)
+
+		if err := ctx.ResetStorage.Persist(ctx.Context(), r); err != nil {
+			return err
+		}
+
+		if err := ctx.ResetStorage.ExpireOutstanding(ctx.Context(), u.UserID, *r.UsedAt); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+// ChangePassword replaces the password of a logged-in user. With logoutOthers
+// every session except the one identified by authId is revoked.
+func (s *Service) ChangePassword(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	authId string,
+	oldPassword string,
+	newPassword string,
+	logoutOthers bool,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		if err := s.passwordPolicy.Validate(newPassword, u.Email); err != nil {
+			return err
+		}
+
+		if err := u.ChangePassword(oldPassword, newPassword, s.Authorizer); err != nil {
+			return err
+		}
+
+		if logoutOthers {
+			if err := u.RevokeOtherSessions(authId); err != nil {
+				return err
+			}
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
@@ -0,0 +1,68 @@
+package authapp
+
+import (
+	"context"
+	"github.com/burenotti/go_health_backend/internal/adapter/cache"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"time"
+)
+
+type RevocationStorage interface {
+	IsAuthorizationRevoked(ctx context.Context, authId string) (bool, error)
+}
+
+// RevocationList tells whether the authorization an access token was issued
+// for is still alive. Answers are cached, so the storage is only queried for
+// authorizations that have not been seen recently. Revocations made by this
+// instance are applied to the cache through logout events; the ones made by
+// other instances are noticed once the cached answer expires after activeTTL.
+type RevocationList struct {
+	storage    RevocationStorage
+	cache      *cache.LRU[string, bool]
+	revokedTTL time.Duration
+	activeTTL  time.Duration
+}
+
+func NewRevocationList(
+	storage RevocationStorage,
+	size int,
+	revokedTTL time.Duration,
+	activeTTL time.Duration,
+) *RevocationList {
+	return &RevocationList{
+		storage:    storage,
+		cache:      cache.NewLRU[string, bool](size),
+		revokedTTL: revokedTTL,
+		activeTTL:  activeTTL,
+	}
+}
+
+func (r *RevocationList) IsRevoked(ctx context.Context, authId string) (bool, error) {
+	if revoked, ok := r.cache.Get(authId); ok {
+		return revoked, nil
+	}
+
+	revoked, err := r.storage.IsAuthorizationRevoked(ctx, authId)
+	if err != nil {
+		return false, err
+	}
+
+	if revoked {
+		r.cache.Set(authId, true, r.revokedTTL)
+	} else {
+		r.cache.Set(authId, false, r.activeTTL)
+	}
+	return revoked, nil
+}
+
+func (r *RevocationList) Revoke(authId string) {
+	r.cache.Set(authId, true, r.revokedTTL)
+}
+
+func (r *RevocationList) HandleLogout(event domain.Event) error {
+	if e, ok := event.(auth.LogoutEvent); ok {
+		r.Revoke(e.ID)
+	}
+	return nil
+}
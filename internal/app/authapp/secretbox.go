@@ -0,0 +1,69 @@
+package authapp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const sealedPrefix = "enc:v1:"
+
+var (
+	ErrInvalidSecretKey = errors.New("secret key must be 32 bytes")
+	errSealedValue      = errors.New("failed to open sealed value")
+)
+
+// SecretBox encrypts secrets that have to be stored recoverable, like TOTP
+// keys, with AES-256-GCM. Sealed values carry a version prefix, so the
+// format can change later.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidSecretKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+func (b *SecretBox) Seal(plaintext string) string {
+	nonce := make([]byte, b.aead.NonceSize())
+	if n, err := rand.Read(nonce); n != len(nonce) || err != nil {
+		panic("failed to generate nonce")
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// Open returns the plaintext of a sealed value.
+func (b *SecretBox) Open(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return "", errSealedValue
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", errSealedValue
+	}
+
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	raw, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errSealedValue
+	}
+	return string(raw), nil
+}
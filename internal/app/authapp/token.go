@@ -0,0 +1,24 @@
+package authapp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// newToken generates a random single-use token and the hash it is stored by.
+func newToken() (token string, hash string) {
+	var bytes [32]byte
+	if n, err := rand.Read(bytes[:]); n != len(bytes) || err != nil {
+		panic("failed to generate token")
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(bytes[:])
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
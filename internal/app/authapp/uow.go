@@ -5,9 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	attemptstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/attempts"
+	auditstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/audit"
+	emailchangestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/emailchanges"
+	magiclinkstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/magiclinks"
+	mfachallengestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/mfachallenges"
+	resetstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/resets"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
 	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
 	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"time"
 )
 
 type UserStorage interface {
@@ -16,18 +25,81 @@ type UserStorage interface {
 	GetByID(ctx context.Context, userId string) (*auth.User, error)
 	GetByAuthID(ctx context.Context, authId string) (*auth.User, error)
 	GetByAuthSecret(ctx context.Context, authId string) (*auth.User, error)
+	GetByIdentity(ctx context.Context, provider, subject string) (*auth.User, error)
 	Persist(ctx context.Context, u *auth.User) error
 	CollectEvents() []domain.Event
 	Close() error
 }
 
+type ResetStorage interface {
+	Add(ctx context.Context, r *auth.PasswordReset) error
+	GetByID(ctx context.Context, resetID string) (*auth.PasswordReset, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*auth.PasswordReset, error)
+	ExpireOutstanding(ctx context.Context, userID string, now time.Time) error
+	Persist(ctx context.Context, r *auth.PasswordReset) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AttemptStorage interface {
+	Get(ctx context.Context, scope, subject string) (*auth.LoginAttempts, error)
+	Persist(ctx context.Context, l *auth.LoginAttempts) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type MagicLinkStorage interface {
+	Add(ctx context.Context, l *auth.MagicLink) error
+	GetByID(ctx context.Context, linkID string) (*auth.MagicLink, error)
+	Persist(ctx context.Context, l *auth.MagicLink) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type EmailChangeStorage interface {
+	Add(ctx context.Context, c *auth.EmailChange) error
+	GetByID(ctx context.Context, changeID string) (*auth.EmailChange, error)
+	Persist(ctx context.Context, c *auth.EmailChange) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type ChallengeStorage interface {
+	Add(ctx context.Context, c *auth.SecondFactorChallenge) error
+	GetByID(ctx context.Context, challengeID string) (*auth.SecondFactorChallenge, error)
+	Persist(ctx context.Context, c *auth.SecondFactorChallenge) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AuditStorage interface {
+	Add(ctx context.Context, e *audit.Entry) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
 type AtomicContext struct {
 	ctx context.Context
 	storage.DBContext
-	UserStorage UserStorage
+	UserStorage        UserStorage
+	ResetStorage       ResetStorage
+	AttemptStorage     AttemptStorage
+	MagicLinkStorage   MagicLinkStorage
+	EmailChangeStorage EmailChangeStorage
+	ChallengeStorage   ChallengeStorage
+	AuditStorage       AuditStorage
+
+	events []domain.Event
 }
 
+// Commit writes the audit log entries for the events of the transaction
+// before committing it.
 func (a *AtomicContext) Commit() error {
+	events := a.collectEvents()
+	a.events = append(a.events, events...)
+	if err := auditapp.RecordEvents(a.ctx, a.AuditStorage, events); err != nil {
+		return err
+	}
 	return a.DBContext.Commit()
 }
 
@@ -36,6 +108,30 @@ func (a *AtomicContext) Close() (err error) {
 		err = errors.Join(err, closeErr)
 	}
 
+	if closeErr := a.ResetStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AttemptStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.MagicLinkStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.EmailChangeStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.ChallengeStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AuditStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
 	if err != nil {
 		err = errors.Join(fmt.Errorf("failed to close storage"), err)
 	}
@@ -44,7 +140,31 @@ func (a *AtomicContext) Close() (err error) {
 }
 
 func (a *AtomicContext) CollectEvents() []domain.Event {
-	return a.UserStorage.CollectEvents()
+	events := append(a.events, a.collectEvents()...)
+	a.events = nil
+	return events
+}
+
+func (a *AtomicContext) collectEvents() []domain.Event {
+	userEvents := a.UserStorage.CollectEvents()
+	resetEvents := a.ResetStorage.CollectEvents()
+	attemptEvents := a.AttemptStorage.CollectEvents()
+	linkEvents := a.MagicLinkStorage.CollectEvents()
+	changeEvents := a.EmailChangeStorage.CollectEvents()
+	challengeEvents := a.ChallengeStorage.CollectEvents()
+
+	events := make(
+		[]domain.Event,
+		0,
+		len(userEvents)+len(resetEvents)+len(attemptEvents)+len(linkEvents)+len(changeEvents)+len(challengeEvents),
+	)
+	events = append(events, userEvents...)
+	events = append(events, resetEvents...)
+	events = append(events, attemptEvents...)
+	events = append(events, linkEvents...)
+	events = append(events, changeEvents...)
+	events = append(events, challengeEvents...)
+	return events
 }
 
 func (a *AtomicContext) Context() context.Context {
@@ -53,8 +173,14 @@ func (a *AtomicContext) Context() context.Context {
 
 func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
 	return &AtomicContext{
-		ctx:         ctx,
-		DBContext:   dbContext,
-		UserStorage: userstorage.NewPostgresStorage(dbContext, nil),
+		ctx:                ctx,
+		DBContext:          dbContext,
+		UserStorage:        userstorage.NewPostgresStorage(dbContext, nil),
+		ResetStorage:       resetstorage.NewPostgresStorage(dbContext),
+		AttemptStorage:     attemptstorage.NewPostgresStorage(dbContext),
+		MagicLinkStorage:   magiclinkstorage.NewPostgresStorage(dbContext),
+		EmailChangeStorage: emailchangestorage.NewPostgresStorage(dbContext),
+		ChallengeStorage:   mfachallengestorage.NewPostgresStorage(dbContext),
+		AuditStorage:       auditstorage.NewPostgresStorage(dbContext),
 	}, nil
 }
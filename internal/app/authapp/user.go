@@ -4,27 +4,151 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/burenotti/go_health_backend/internal/app/passwordpolicy"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/domain/auth"
 	"log/slog"
+	"time"
 )
 
 var (
 	ErrInvalidAuthorization = errors.New("invalid authorization")
 )
 
+var (
+	defaultAccountLockout = auth.LockoutPolicy{
+		MaxFailures:  5,
+		Window:       15 * time.Minute,
+		LockDuration: 15 * time.Minute,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+	}
+	defaultAddressLockout = auth.LockoutPolicy{
+		MaxFailures:  50,
+		Window:       time.Hour,
+		LockDuration: time.Hour,
+	}
+)
+
 type Service struct {
-	logger     *slog.Logger
-	Authorizer *Authorizer
+	logger               *slog.Logger
+	Authorizer           *Authorizer
+	links                *LinkSigner
+	passwordResetTTL     time.Duration
+	verificationTTL      time.Duration
+	requireVerifiedEmail bool
+	mfaIssuer            string
+	mfaChallengeTTL      time.Duration
+	accountLockout       auth.LockoutPolicy
+	addressLockout       auth.LockoutPolicy
+	providers            map[string]IdentityProvider
+	passwordPolicy       *passwordpolicy.Policy
+	externalStateTTL     time.Duration
+	magicLinkTTL         time.Duration
+	linkAddressLimit     auth.LockoutPolicy
+	linkEmailLimit       auth.LockoutPolicy
+	emailChangeTTL       time.Duration
+	emailChangeUndoTTL   time.Duration
+}
+
+type ServiceOption func(*Service)
+
+func PasswordResetTTL(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.passwordResetTTL = ttl
+	}
+}
+
+func EmailVerification(ttl time.Duration, requiredForLogin bool) ServiceOption {
+	return func(s *Service) {
+		s.verificationTTL = ttl
+		s.requireVerifiedEmail = requiredForLogin
+	}
+}
+
+func SecondFactor(issuer string, challengeTTL time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.mfaIssuer = issuer
+		s.mfaChallengeTTL = challengeTTL
+	}
 }
 
-func NewService(auth *Authorizer, logger *slog.Logger) *Service {
-	return &Service{
-		logger:     logger,
-		Authorizer: auth,
+// Lockout sets the thresholds for failed logins. The account policy applies
+// per user, the address policy per client IP address.
+func Lockout(account, address auth.LockoutPolicy) ServiceOption {
+	return func(s *Service) {
+		s.accountLockout = account
+		s.addressLockout = address
 	}
 }
 
+// ExternalProviders enables login with OpenID Connect providers by name.
+// The state of a started login is valid for stateTTL.
+func ExternalProviders(providers map[string]IdentityProvider, stateTTL time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.providers = providers
+		s.externalStateTTL = stateTTL
+	}
+}
+
+// PasswordPolicy sets the rules new passwords are checked against.
+func PasswordPolicy(policy *passwordpolicy.Policy) ServiceOption {
+	return func(s *Service) {
+		s.passwordPolicy = policy
+	}
+}
+
+// MagicLink sets how long a passwordless login link stays valid.
+func MagicLink(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.magicLinkTTL = ttl
+	}
+}
+
+// MagicLinkRequests limits how many links a client address and a mailbox
+// can request within window. Exceeding the limit blocks further requests
+// for the rest of the window.
+func MagicLinkRequests(perAddress, perEmail int, window time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.linkAddressLimit = auth.LockoutPolicy{MaxFailures: perAddress, Window: window, LockDuration: window}
+		s.linkEmailLimit = auth.LockoutPolicy{MaxFailures: perEmail, Window: window, LockDuration: window}
+	}
+}
+
+// EmailChange sets how long the new address can be confirmed and how long
+// the change can be undone from the old one.
+func EmailChange(ttl, undoTTL time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.emailChangeTTL = ttl
+		s.emailChangeUndoTTL = undoTTL
+	}
+}
+
+func NewService(auth *Authorizer, links *LinkSigner, logger *slog.Logger, opts ...ServiceOption) *Service {
+	s := &Service{
+		logger:             logger,
+		Authorizer:         auth,
+		links:              links,
+		passwordResetTTL:   time.Hour,
+		verificationTTL:    48 * time.Hour,
+		mfaIssuer:          "GoHealth",
+		mfaChallengeTTL:    5 * time.Minute,
+		accountLockout:     defaultAccountLockout,
+		addressLockout:     defaultAddressLockout,
+		externalStateTTL:   10 * time.Minute,
+		passwordPolicy:     passwordpolicy.Default(),
+		magicLinkTTL:       15 * time.Minute,
+		emailChangeTTL:     24 * time.Hour,
+		emailChangeUndoTTL: 7 * 24 * time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
 func (s *Service) CreateUser(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
@@ -32,8 +156,12 @@ func (s *Service) CreateUser(
 	email string,
 	password string,
 ) (u *auth.User, err error) {
+	u, err = s.NewUser(userId, email, password)
+	if err != nil {
+		return nil, err
+	}
+
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		u = auth.NewUser(userId, email, password, s.Authorizer)
 		if err := ctx.UserStorage.Add(ctx.Context(), u); err != nil {
 			return err
 		}
@@ -43,43 +171,183 @@ func (s *Service) CreateUser(
 	return
 }
 
+// NewUser checks the password against the policy and creates the user
+// without storing it, so other services can sign users up in their own
+// transactions.
+func (s *Service) NewUser(userId, email, password string) (*auth.User, error) {
+	if err := s.passwordPolicy.Validate(password, email); err != nil {
+		return nil, err
+	}
+	return auth.NewUser(userId, email, password, s.Authorizer), nil
+}
+
+// StartSession logs in a user created by NewUser before it is stored. No
+// session is started while login requires a verified email.
+func (s *Service) StartSession(u *auth.User, device auth.Device) (Tokens, error) {
+	if s.requireVerifiedEmail && !u.IsVerified() {
+		return Tokens{}, nil
+	}
+
+	a, err := u.AuthorizeNewUser(s.Authorizer, device)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	accessToken, err := s.Authorizer.GenerateAccessToken(u, a)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: a.Secret,
+	}, nil
+}
+
+type LoginResult struct {
+	Tokens   Tokens
+	MFAToken string
+	// ReauthToken is set instead of the tokens when the external login was
+	// started with StartReauthentication.
+	ReauthToken string
+}
+
+// Login authorizes the user with the password. When the second factor is
+// enabled no authorization is created; a challenge token for
+// CompleteSecondFactor is returned instead.
+//
+// Failed attempts are counted per account and per client address; once a
+// limit is reached Login returns *auth.LoginThrottledError.
 func (s *Service) Login(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
 	device auth.Device,
 	email string,
 	password string,
-) (tokens Tokens, err error) {
+) (res LoginResult, err error) {
+	var loginErr error
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		u, err := ctx.UserStorage.GetByEmail(ctx.Context(), email)
+		now := time.Now().UTC()
 
+		address, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAddress, device.IPAddress)
 		if err != nil {
 			return err
 		}
+		if err := address.Check(now); err != nil {
+			return err
+		}
 
-		a, err := u.Authorize(s.Authorizer, password, device)
+		u, err := ctx.UserStorage.GetByEmail(ctx.Context(), email)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			s.Authorizer.SimulatePasswordCheck(password)
+			// The failure must be stored even though the login fails.
+			loginErr = err
+			return s.registerFailure(ctx, now, address)
+		}
 		if err != nil {
 			return err
 		}
 
-		accessToken, err := s.Authorizer.GenerateAccessToken(u, a)
+		account, err := ctx.AttemptStorage.Get(ctx.Context(), auth.AttemptScopeAccount, u.UserID)
 		if err != nil {
 			return err
 		}
+		if err := account.Check(now); err != nil {
+			return err
+		}
 
-		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+		a, err := u.Authorize(s.Authorizer, password, device)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			loginErr = err
+			// Persisting publishes the failed login event.
+			if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+				return err
+			}
+			return s.registerFailure(ctx, now, address, account)
+		}
+		if err != nil && !errors.Is(err, auth.ErrSecondFactorRequired) {
 			return err
 		}
 
-		tokens = Tokens{
-			AccessToken:  accessToken,
-			RefreshToken: a.Secret,
+		if s.requireVerifiedEmail && !u.IsVerified() {
+			return auth.ErrEmailNotVerified
 		}
-		return ctx.Commit()
+
+		account.Reset()
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), account); err != nil {
+			return err
+		}
+
+		if a == nil {
+			// The hash may have been upgraded even though no session is issued yet.
+			if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+				return err
+			}
+			res.MFAToken, err = s.newSecondFactorChallenge(ctx, u.UserID)
+			if err != nil {
+				return err
+			}
+			return ctx.Commit()
+		}
+
+		res.Tokens, err = s.issueTokens(ctx, u, a)
+		return err
 	})
+	if err == nil {
+		err = loginErr
+	}
 	return
 }
 
+func (s *Service) registerFailure(ctx *AtomicContext, now time.Time, attempts ...*auth.LoginAttempts) error {
+	if err := s.countAttempts(ctx, now, attempts...); err != nil {
+		return err
+	}
+	return ctx.Commit()
+}
+
+func (s *Service) countAttempts(ctx *AtomicContext, now time.Time, attempts ...*auth.LoginAttempts) error {
+	for _, l := range attempts {
+		if l.Fail(s.lockoutPolicy(l.Scope), now) {
+			s.logger.Warn("login locked after failed attempts", "scope", l.Scope, "subject", l.Subject)
+		}
+
+		if err := ctx.AttemptStorage.Persist(ctx.Context(), l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) lockoutPolicy(scope string) auth.LockoutPolicy {
+	switch scope {
+	case auth.AttemptScopeAddress:
+		return s.addressLockout
+	case auth.AttemptScopeLinkAddress:
+		return s.linkAddressLimit
+	case auth.AttemptScopeEmail:
+		return s.linkEmailLimit
+	default:
+		return s.accountLockout
+	}
+}
+
+func (s *Service) issueTokens(ctx *AtomicContext, u *auth.User, a *auth.Authorization) (Tokens, error) {
+	accessToken, err := s.Authorizer.GenerateAccessToken(u, a)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+		return Tokens{}, err
+	}
+
+	tokens := Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: a.Secret,
+	}
+	return tokens, ctx.Commit()
+}
+
 func (s *Service) Logout(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
@@ -108,23 +376,50 @@ func (s *Service) Logout(
 func (s *Service) Refresh(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
-	authId string,
+	refreshToken string,
 ) (tokens Tokens, err error) {
+	var reuseErr error
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		user, err := ctx.UserStorage.GetByAuthID(ctx.Context(), authId)
+		user, err := ctx.UserStorage.GetByAuthSecret(ctx.Context(), refreshToken)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				return fmt.Errorf("%w: refresh token not found", ErrInvalidAuthorization)
+			}
+			return err
+		}
+
+		a, err := user.Refresh(s.Authorizer, refreshToken)
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			s.logger.Warn("refresh token reuse detected", "user_id", user.UserID)
+			// The revoked family must be stored even though the refresh fails.
+			reuseErr = err
+			if err := ctx.UserStorage.Persist(ctx.Context(), user); err != nil {
+				return err
+			}
+			return ctx.Commit()
+		}
+		if err != nil {
+			return errors.Join(err, ErrInvalidAuthorization)
+		}
+
+		accessToken, err := s.Authorizer.GenerateAccessToken(user, a)
 		if err != nil {
 			return err
 		}
 
-		a := user.GetAuthByID(authId)
-		if !a.IsActive() {
-			return fmt.Errorf("%w: authorization is not active", ErrInvalidAuthorization)
+		if err := ctx.UserStorage.Persist(ctx.Context(), user); err != nil {
+			return err
 		}
 
-		tokens.AccessToken, err = s.Authorizer.GenerateAccessToken(user, a)
-		tokens.RefreshToken = a.Secret
-		return err
+		tokens = Tokens{
+			AccessToken:  accessToken,
+			RefreshToken: a.Secret,
+		}
+		return ctx.Commit()
 	})
+	if err == nil && reuseErr != nil {
+		err = errors.Join(reuseErr, ErrInvalidAuthorization)
+	}
 	return
 }
 
@@ -132,3 +427,92 @@ type Tokens struct {
 	AccessToken  string
 	RefreshToken string
 }
+
+type Session struct {
+	ID          string
+	Device      auth.Device
+	StartedAt   time.Time
+	RefreshedAt time.Time
+	ValidUntil  time.Time
+	Current     bool
+}
+
+func (s *Service) ListSessions(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	currentAuthId string,
+) (sessions []Session, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		var currentFamily string
+		if current := u.GetAuthByID(currentAuthId); current != nil {
+			currentFamily = current.FamilyID
+		}
+
+		for _, a := range u.Sessions() {
+			sessions = append(sessions, Session{
+				ID:          a.FamilyID,
+				Device:      a.Device,
+				StartedAt:   u.SessionStartedAt(a.FamilyID),
+				RefreshedAt: a.CreatedAt,
+				ValidUntil:  a.ValidUntil,
+				Current:     a.FamilyID == currentFamily,
+			})
+		}
+		return nil
+	})
+	return
+}
+
+func (s *Service) RevokeSession(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	sessionId string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		if err := u.RevokeSession(sessionId); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+func (s *Service) RevokeOtherSessions(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+	currentAuthId string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		if err := u.RevokeOtherSessions(currentAuthId); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
@@ -0,0 +1,71 @@
+package authapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/golang-jwt/jwt"
+)
+
+func (s *Service) EmailVerificationToken(userId string, email string) (string, error) {
+	return s.links.Sign(PurposeVerifyEmail, userId, s.verificationTTL, jwt.MapClaims{
+		"email": email,
+	})
+}
+
+func (s *Service) VerifyEmail(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	token string,
+) error {
+	claims, err := s.links.Verify(PurposeVerifyEmail, token)
+	if err != nil {
+		return errors.Join(err, auth.ErrVerificationInvalid)
+	}
+	userId, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				return auth.ErrVerificationInvalid
+			}
+			return err
+		}
+
+		if err := u.VerifyEmail(email); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+func (s *Service) ResendEmailVerification(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	userId string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		u, err := ctx.UserStorage.GetByID(ctx.Context(), userId)
+		if err != nil {
+			return err
+		}
+
+		if err := u.RequestEmailVerification(); err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Persist(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
@@ -0,0 +1,179 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+)
+
+var (
+	ErrForbidden = errors.New("forbidden")
+)
+
+type Action string
+
+const (
+	ActionCreateGroup      Action = "group.create"
+	ActionReadGroup        Action = "group.read"
+	ActionReadGroupMembers Action = "group.read_members"
+	ActionCreateInvite     Action = "invite.create"
+	ActionAcceptInvite     Action = "invite.accept"
+	ActionCreateMetric     Action = "metric.create"
+	ActionReadMetrics      Action = "metric.read"
+	ActionExportData       Action = "data.export"
+)
+
+const (
+	ResourceGroup   = "group"
+	ResourceTrainee = "trainee"
+)
+
+// Subject is the user performing an action.
+type Subject struct {
+	UserID string
+}
+
+type Resource struct {
+	Type string
+	ID   string
+}
+
+func Group(groupID group.GroupID) Resource {
+	return Resource{Type: ResourceGroup, ID: string(groupID)}
+}
+
+func Trainee(traineeID string) Resource {
+	return Resource{Type: ResourceTrainee, ID: traineeID}
+}
+
+type Profiles interface {
+	GetByID(ctx context.Context, userID string) (profile.Profile, error)
+}
+
+type Groups interface {
+	GetByID(ctx context.Context, groupID group.GroupID) (*group.Group, error)
+	IsGroupMember(ctx context.Context, groupID group.GroupID, traineeID group.TraineeID) (bool, error)
+	IsCoachOf(ctx context.Context, coachID group.CoachID, traineeID group.TraineeID) (bool, error)
+}
+
+type rule func(ctx context.Context, p *Policy, sub Subject, res Resource) (bool, error)
+
+var rules = map[Action]rule{
+	ActionCreateGroup:      isCoach,
+	ActionReadGroup:        isGroupCoachOrMember,
+	ActionReadGroupMembers: isGroupCoachOrMember,
+	ActionCreateInvite:     isActiveGroupCoach,
+	ActionAcceptInvite:     isTrainee,
+	ActionCreateMetric:     isSelfTrainee,
+	ActionReadMetrics:      isSelfOrCoach,
+	ActionExportData:       isSelfTrainee,
+}
+
+// Policy decides whether a subject may perform an action on a resource.
+// It reads relations through the storages of the current unit of work.
+type Policy struct {
+	profiles Profiles
+	groups   Groups
+}
+
+func New(profiles Profiles, groups Groups) *Policy {
+	return &Policy{
+		profiles: profiles,
+		groups:   groups,
+	}
+}
+
+func (p *Policy) Can(ctx context.Context, sub Subject, action Action, res Resource) (bool, error) {
+	r, ok := rules[action]
+	if !ok || sub.UserID == "" {
+		return false, nil
+	}
+	return r(ctx, p, sub, res)
+}
+
+// Authorize is Can that reports a denial as ErrForbidden.
+func (p *Policy) Authorize(ctx context.Context, sub Subject, action Action, res Resource) error {
+	ok, err := p.Can(ctx, sub, action, res)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (p *Policy) profileType(ctx context.Context, userID string) (string, error) {
+	pr, err := p.profiles.GetByID(ctx, userID)
+	if errors.Is(err, profile.ErrProfileNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return pr.Type(), nil
+}
+
+func isCoach(ctx context.Context, p *Policy, sub Subject, _ Resource) (bool, error) {
+	t, err := p.profileType(ctx, sub.UserID)
+	return t == profile.TypeCoach, err
+}
+
+func isTrainee(ctx context.Context, p *Policy, sub Subject, _ Resource) (bool, error) {
+	t, err := p.profileType(ctx, sub.UserID)
+	return t == profile.TypeTrainee, err
+}
+
+// group returns nil for a missing group, so rules deny access to it the same
+// way they do to a group of someone else and don't reveal it doesn't exist.
+func (p *Policy) group(ctx context.Context, res Resource) (*group.Group, error) {
+	if res.Type != ResourceGroup {
+		return nil, nil
+	}
+	g, err := p.groups.GetByID(ctx, group.GroupID(res.ID))
+	if errors.Is(err, group.ErrGroupNotFound) {
+		return nil, nil
+	}
+	return g, err
+}
+
+func isGroupCoach(ctx context.Context, p *Policy, sub Subject, res Resource) (bool, error) {
+	g, err := p.group(ctx, res)
+	if g == nil || err != nil {
+		return false, err
+	}
+	return string(g.CoachID) == sub.UserID, nil
+}
+
+func isActiveGroupCoach(ctx context.Context, p *Policy, sub Subject, res Resource) (bool, error) {
+	g, err := p.group(ctx, res)
+	if g == nil || err != nil {
+		return false, err
+	}
+	return !g.IsArchived() && string(g.CoachID) == sub.UserID, nil
+}
+
+func isGroupCoachOrMember(ctx context.Context, p *Policy, sub Subject, res Resource) (bool, error) {
+	if ok, err := isGroupCoach(ctx, p, sub, res); ok || err != nil {
+		return ok, err
+	}
+	return p.groups.IsGroupMember(ctx, group.GroupID(res.ID), group.TraineeID(sub.UserID))
+}
+
+func isSelfTrainee(ctx context.Context, p *Policy, sub Subject, res Resource) (bool, error) {
+	if res.Type != ResourceTrainee || res.ID != sub.UserID {
+		return false, nil
+	}
+	return isTrainee(ctx, p, sub, res)
+}
+
+func isSelfOrCoach(ctx context.Context, p *Policy, sub Subject, res Resource) (bool, error) {
+	if res.Type != ResourceTrainee {
+		return false, nil
+	}
+	if res.ID == sub.UserID {
+		return true, nil
+	}
+	return p.groups.IsCoachOf(ctx, group.CoachID(sub.UserID), group.TraineeID(res.ID))
+}
@@ -0,0 +1,200 @@
+package exportapp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/invite"
+	"github.com/burenotti/go_health_backend/internal/domain/metric"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type personalData struct {
+	User    *auth.User
+	Profile profile.Profile
+	Groups  []*group.Group
+	Invites []*invite.Invite
+	Metrics []*metric.Metric
+}
+
+type accountFile struct {
+	UserID              string     `json:"user_id"`
+	Email               string     `json:"email"`
+	VerifiedAt          *time.Time `json:"verified_at"`
+	SecondFactorEnabled bool       `json:"second_factor_enabled"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type profileFile struct {
+	UserID          string     `json:"user_id"`
+	Type            string     `json:"type"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	BirthDate       *time.Time `json:"birth_date"`
+	YearsExperience int        `json:"years_experience,omitempty"`
+	Bio             string     `json:"bio,omitempty"`
+}
+
+type groupFile struct {
+	GroupID     string     `json:"group_id"`
+	CoachID     string     `json:"coach_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+}
+
+func buildArchive(d personalData) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	if err := writeJSON(w, "account.json", accountFile{
+		UserID:              d.User.UserID,
+		Email:               d.User.Email,
+		VerifiedAt:          d.User.VerifiedAt,
+		SecondFactorEnabled: d.User.SecondFactorEnabled(),
+		CreatedAt:           d.User.CreatedAt,
+		UpdatedAt:           d.User.UpdatedAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	if d.Profile != nil {
+		if err := writeJSON(w, "profile.json", toProfileFile(d.Profile)); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := make([]groupFile, 0, len(d.Groups))
+	for _, g := range d.Groups {
+		groups = append(groups, groupFile{
+			GroupID:     string(g.GroupID),
+			CoachID:     string(g.CoachID),
+			Name:        g.Name,
+			Description: g.Description,
+			ArchivedAt:  g.ArchivedAt,
+		})
+	}
+	if err := writeJSON(w, "groups.json", groups); err != nil {
+		return nil, err
+	}
+
+	sessions := [][]string{{
+		"authorization_id", "session_id", "created_at", "valid_until", "logout_at",
+		"browser", "os", "ip_address", "device_model", "country", "asn", "as_org",
+	}}
+	for _, a := range d.User.Authorizations {
+		sessions = append(sessions, []string{
+			a.ID,
+			a.FamilyID,
+			formatTime(&a.CreatedAt),
+			formatTime(&a.ValidUntil),
+			formatTime(a.LogoutAt),
+			a.Device.Browser,
+			a.Device.OS,
+			a.Device.IPAddress,
+			a.Device.Model,
+			a.Device.Country,
+			strconv.FormatUint(uint64(a.Device.ASN), 10),
+			a.Device.ASOrg,
+		})
+	}
+	if err := writeCSV(w, "sessions.csv", sessions); err != nil {
+		return nil, err
+	}
+
+	invites := [][]string{{"invite_id", "group_id", "accepted_at"}}
+	for _, inv := range d.Invites {
+		for _, accept := range inv.AcceptedBy {
+			invites = append(invites, []string{
+				string(inv.InviteID),
+				string(inv.GroupID),
+				formatTime(&accept.AcceptedAt),
+			})
+		}
+	}
+	if err := writeCSV(w, "invites.csv", invites); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(d.Metrics, func(i, j int) bool {
+		return d.Metrics[i].CreatedAt.Before(d.Metrics[j].CreatedAt)
+	})
+	metrics := [][]string{{"metric_id", "heart_rate", "weight", "height", "created_at"}}
+	for _, m := range d.Metrics {
+		metrics = append(metrics, []string{
+			m.MetricID,
+			strconv.Itoa(m.HeartRate),
+			strconv.Itoa(m.Weight),
+			strconv.Itoa(m.Height),
+			formatTime(&m.CreatedAt),
+		})
+	}
+	if err := writeCSV(w, "metrics.csv", metrics); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toProfileFile(p profile.Profile) profileFile {
+	switch v := p.(type) {
+	case *profile.Coach:
+		return profileFile{
+			UserID:          v.UserID,
+			Type:            v.Type(),
+			FirstName:       v.FirstName,
+			LastName:        v.LastName,
+			BirthDate:       v.BirthDate,
+			YearsExperience: v.YearsExperience,
+			Bio:             v.Bio,
+		}
+	case *profile.Trainee:
+		return profileFile{
+			UserID:    v.UserID,
+			Type:      v.Type(),
+			FirstName: v.FirstName,
+			LastName:  v.LastName,
+			BirthDate: v.BirthDate,
+		}
+	default:
+		panic("unknown profile type")
+	}
+}
+
+func writeJSON(w *zip.Writer, name string, v any) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(w *zip.Writer, name string, records [][]string) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(f)
+	return cw.WriteAll(records)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,215 @@
+package exportapp
+
+import (
+	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/export"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/invite"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"log/slog"
+	"time"
+)
+
+type Service struct {
+	logger *slog.Logger
+	links  *authapp.LinkSigner
+	ttl    time.Duration
+}
+
+// New creates the service. Finished archives can be downloaded for ttl.
+func New(links *authapp.LinkSigner, ttl time.Duration, logger *slog.Logger) *Service {
+	return &Service{
+		logger: logger,
+		links:  links,
+		ttl:    ttl,
+	}
+}
+
+// RequestExport registers an export of the subject's data. The archive is
+// built in the background by the handler returned from HandleRequested.
+func (s *Service) RequestExport(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
+) (e *export.Export, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		resource := authz.Trainee(subject.UserID)
+		if err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionExportData, resource); err != nil {
+			return err
+		}
+
+		if err := ctx.ExportStorage.DeleteExpired(ctx.Context(), time.Now().UTC()); err != nil {
+			return err
+		}
+
+		e = export.New(uuid.New().String(), subject.UserID)
+		if err := ctx.ExportStorage.Add(ctx.Context(), e); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+	return
+}
+
+// GetExport returns the export of the subject and, once it is ready, a
+// token for DownloadExport that expires together with the archive.
+func (s *Service) GetExport(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
+	exportID string,
+) (e *export.Export, token string, err error) {
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		var err error
+		e, err = ctx.ExportStorage.GetByID(ctx.Context(), exportID)
+		if err != nil {
+			return err
+		}
+		if e.UserID != subject.UserID {
+			return export.ErrExportNotFound
+		}
+
+		if e.Status == export.StatusReady && time.Now().Before(*e.ExpiresAt) {
+			token, err = s.links.Sign(authapp.PurposeDataExport, e.ExportID, time.Until(*e.ExpiresAt), nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		return ctx.Commit()
+	})
+	return
+}
+
+func (s *Service) DownloadExport(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	token string,
+) (archive []byte, err error) {
+	claims, err := s.links.Verify(authapp.PurposeDataExport, token)
+	if err != nil {
+		return nil, err
+	}
+	exportID, _ := claims["sub"].(string)
+
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		e, err := ctx.ExportStorage.GetByID(ctx.Context(), exportID)
+		if err != nil {
+			return err
+		}
+
+		if archive, err = e.Download(); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+	return
+}
+
+// HandleRequested returns the message bus handler building the archives.
+func (s *Service) HandleRequested(uow *unitofwork.UnitOfWork[*AtomicContext]) func(domain.Event) error {
+	return func(event domain.Event) error {
+		e, ok := event.(export.RequestedEvent)
+		if !ok {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err := s.buildExport(ctx, uow, e.ExportID)
+		if err == nil {
+			return nil
+		}
+
+		s.logger.Error("failed to build data export", "export_id", e.ExportID, "error", err)
+
+		// The build may have failed because its deadline passed.
+		failCtx, cancelFail := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelFail()
+
+		return uow.Atomic(failCtx, func(ctx *AtomicContext) error {
+			ex, err := ctx.ExportStorage.GetByID(ctx.Context(), e.ExportID)
+			if err != nil {
+				return err
+			}
+
+			ex.Fail()
+			if err := ctx.ExportStorage.Persist(ctx.Context(), ex); err != nil {
+				return err
+			}
+			return ctx.Commit()
+		})
+	}
+}
+
+func (s *Service) buildExport(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	exportID string,
+) error {
+	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		e, err := ctx.ExportStorage.GetByID(ctx.Context(), exportID)
+		if err != nil {
+			return err
+		}
+
+		data, err := s.collect(ctx, e.UserID)
+		if err != nil {
+			return err
+		}
+
+		archive, err := buildArchive(data)
+		if err != nil {
+			return err
+		}
+
+		e.Complete(archive, s.ttl)
+		if err := ctx.ExportStorage.Persist(ctx.Context(), e); err != nil {
+			return err
+		}
+
+		return ctx.Commit()
+	})
+}
+
+func (s *Service) collect(ctx *AtomicContext, userID string) (d personalData, err error) {
+	if d.User, err = ctx.UserStorage.GetByID(ctx.Context(), userID); err != nil {
+		return d, err
+	}
+
+	d.Profile, err = ctx.ProfileStorage.GetByID(ctx.Context(), userID)
+	if errors.Is(err, profile.ErrProfileNotFound) {
+		return d, nil
+	}
+	if err != nil {
+		return d, err
+	}
+
+	groups, err := ctx.GroupStorage.ListByTrainee(ctx.Context(), group.TraineeID(userID), 0, 0)
+	if err != nil {
+		return d, err
+	}
+	d.Groups = lo.Values(groups)
+
+	invites, err := ctx.InviteStorage.ListAcceptedByTrainee(ctx.Context(), invite.TraineeID(userID))
+	if err != nil {
+		return d, err
+	}
+	d.Invites = lo.Values(invites)
+
+	if d.Metrics, err = ctx.MetricStorage.ListByTrainee(ctx.Context(), userID); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
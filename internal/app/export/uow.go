@@ -0,0 +1,111 @@
+package exportapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	exportstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/exports"
+	groupstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/groups"
+	invitestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/invites"
+	metricstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/metrics"
+	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/export"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
+	"github.com/burenotti/go_health_backend/internal/domain/invite"
+	"github.com/burenotti/go_health_backend/internal/domain/metric"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"time"
+)
+
+type ExportStorage interface {
+	Add(ctx context.Context, e *export.Export) error
+	GetByID(ctx context.Context, exportID string) (*export.Export, error)
+	Persist(ctx context.Context, e *export.Export) error
+	DeleteExpired(ctx context.Context, now time.Time) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type UserStorage interface {
+	GetByID(ctx context.Context, userId string) (*auth.User, error)
+}
+
+type ProfileStorage interface {
+	GetByID(ctx context.Context, userId string) (profile.Profile, error)
+}
+
+type GroupStorage interface {
+	ListByTrainee(
+		ctx context.Context,
+		traineeID group.TraineeID,
+		limit, offset int,
+	) (map[group.GroupID]*group.Group, error)
+}
+
+type InviteStorage interface {
+	ListAcceptedByTrainee(
+		ctx context.Context,
+		traineeID invite.TraineeID,
+	) (map[invite.InviteID]*invite.Invite, error)
+}
+
+type MetricStorage interface {
+	ListByTrainee(ctx context.Context, traineeId string) ([]*metric.Metric, error)
+}
+
+type AtomicContext struct {
+	ctx context.Context
+	storage.DBContext
+	ExportStorage  ExportStorage
+	UserStorage    UserStorage
+	ProfileStorage ProfileStorage
+	GroupStorage   GroupStorage
+	InviteStorage  InviteStorage
+	MetricStorage  MetricStorage
+	Policy         *authz.Policy
+}
+
+func (a *AtomicContext) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AtomicContext) Commit() error {
+	return a.DBContext.Commit()
+}
+
+func (a *AtomicContext) Close() (err error) {
+	if closeErr := a.ExportStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		err = errors.Join(fmt.Errorf("failed to close storage"), err)
+	}
+
+	return err
+}
+
+func (a *AtomicContext) CollectEvents() []domain.Event {
+	return a.ExportStorage.CollectEvents()
+}
+
+func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	profiles := profilestorage.NewPostgresStorage(dbContext)
+	groups := groupstorage.NewPostgresStorage(dbContext, nil)
+	return &AtomicContext{
+		ctx:            ctx,
+		DBContext:      dbContext,
+		ExportStorage:  exportstorage.NewPostgresStorage(dbContext),
+		UserStorage:    userstorage.NewPostgresStorage(dbContext, nil),
+		ProfileStorage: profiles,
+		GroupStorage:   groups,
+		InviteStorage:  invitestorage.NewPostgresStorage(dbContext, nil),
+		MetricStorage:  metricstorage.NewPostgresStorage(dbContext),
+		Policy:         authz.New(profiles, groups),
+	}, nil
+}
@@ -2,6 +2,7 @@ package groupservice
 
 import (
 	"context"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/domain/group"
 	"github.com/burenotti/go_health_backend/internal/domain/profile"
@@ -20,12 +21,18 @@ func New(logger *slog.Logger) *Service {
 func (s *Service) CreateGroup(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	groupID group.GroupID,
 	coachID group.CoachID,
 	name string,
 	description string,
 ) error {
 	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionCreateGroup, authz.Group(groupID))
+		if err != nil {
+			return err
+		}
+
 		g := group.New(groupID, coachID, name, description)
 		if err := ctx.GroupStorage.Add(ctx.Context(), g); err != nil {
 			return err
@@ -37,10 +44,15 @@ func (s *Service) CreateGroup(
 func (s *Service) GetByID(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	groupID group.GroupID,
 ) (g *group.Group, err error) {
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		var err error
+		err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionReadGroup, authz.Group(groupID))
+		if err != nil {
+			return err
+		}
+
 		g, err = ctx.GroupStorage.GetByID(ctx.Context(), groupID)
 		return err
 	})
@@ -50,12 +62,17 @@ func (s *Service) GetByID(
 func (s *Service) GetMembers(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	groupID group.GroupID,
 	limit int,
 	offset int,
 ) (m []*group.Member, err error) {
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		var err error
+		err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionReadGroupMembers, authz.Group(groupID))
+		if err != nil {
+			return err
+		}
+
 		m, err = ctx.GroupStorage.GetMembers(ctx.Context(), groupID, limit, offset)
 		return err
 	})
@@ -7,6 +7,7 @@ import (
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage/groups"
 	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/burenotti/go_health_backend/internal/domain"
 	"github.com/burenotti/go_health_backend/internal/domain/group"
 	"github.com/burenotti/go_health_backend/internal/domain/profile"
@@ -44,6 +45,7 @@ type AtomicContext struct {
 	storage.DBContext
 	GroupStorage    GroupStorage
 	ProfilesStorage ProfilesStorage
+	Policy          *authz.Policy
 }
 
 func (a *AtomicContext) Context() context.Context {
@@ -81,10 +83,13 @@ func (a *AtomicContext) CollectEvents() []domain.Event {
 }
 
 func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	groups := groupstorage.NewPostgresStorage(dbContext, nil)
+	profiles := profilestorage.NewPostgresStorage(dbContext)
 	return &AtomicContext{
 		ctx:             ctx,
 		DBContext:       dbContext,
-		GroupStorage:    groupstorage.NewPostgresStorage(dbContext, nil),
-		ProfilesStorage: profilestorage.NewPostgresStorage(dbContext),
+		GroupStorage:    groups,
+		ProfilesStorage: profiles,
+		Policy:          authz.New(profiles, groups),
 	}, nil
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/group"
 	"github.com/burenotti/go_health_backend/internal/domain/invite"
 	"github.com/google/uuid"
 	"log/slog"
@@ -21,9 +23,15 @@ func New(logger *slog.Logger) *Service {
 func (s *Service) CreateInvite(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	groupId invite.GroupID,
 ) (i *invite.Invite, err error) {
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		resource := authz.Group(group.GroupID(groupId))
+		if err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionCreateInvite, resource); err != nil {
+			return err
+		}
+
 		inviteId := invite.InviteID(uuid.Must(uuid.NewUUID()).String())
 		secret := s.generateSecret()
 		i = invite.New(groupId, inviteId, secret)
@@ -41,10 +49,16 @@ func (s *Service) CreateInvite(
 func (s *Service) AcceptInvite(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	traineeId invite.TraineeID,
 	secret string,
 ) error {
 	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		resource := authz.Trainee(string(traineeId))
+		if err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionAcceptInvite, resource); err != nil {
+			return err
+		}
+
 		inv, err := ctx.InvitesStorage.GetBySecret(ctx.Context(), secret)
 		if err != nil {
 			return err
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	groupstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/groups"
 	invitesstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/invites"
+	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/burenotti/go_health_backend/internal/domain"
 	"github.com/burenotti/go_health_backend/internal/domain/invite"
 )
@@ -24,6 +27,7 @@ type AtomicContext struct {
 	ctx            context.Context
 	db             storage.DBContext
 	InvitesStorage InvitesStorage
+	Policy         *authz.Policy
 }
 
 func (a *AtomicContext) Context() context.Context {
@@ -55,5 +59,9 @@ func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*Atomic
 		ctx:            ctx,
 		db:             dbContext,
 		InvitesStorage: invitesstorage.NewPostgresStorage(dbContext, nil),
+		Policy: authz.New(
+			profilestorage.NewPostgresStorage(dbContext),
+			groupstorage.NewPostgresStorage(dbContext, nil),
+		),
 	}, nil
 }
@@ -2,6 +2,8 @@ package metricservice
 
 import (
 	"context"
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/domain/metric"
 	"log/slog"
@@ -18,10 +20,16 @@ func New(logger *slog.Logger) *Service {
 func (s *Service) CreateMetric(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	metricId, traineeId string,
 	heartRate, weight, height int,
 ) error {
 	return uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		resource := authz.Trainee(traineeId)
+		if err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionCreateMetric, resource); err != nil {
+			return err
+		}
+
 		m := metric.New(metricId, traineeId, heartRate, weight, height)
 
 		if err := ctx.MetricStorage.Add(ctx.Context(), m); err != nil {
@@ -35,6 +43,7 @@ func (s *Service) CreateMetric(
 func (s *Service) GetMetricByID(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	metricId string,
 ) (m *metric.Metric, outErr error) {
 	outErr = uow.Atomic(ctx, func(ctx *AtomicContext) error {
@@ -43,6 +52,16 @@ func (s *Service) GetMetricByID(
 			return err
 		}
 
+		// A metric the subject can't read is reported as missing, so its
+		// existence isn't revealed.
+		resource := authz.Trainee(m.TraineeID)
+		if err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionReadMetrics, resource); err != nil {
+			if errors.Is(err, authz.ErrForbidden) {
+				return metric.ErrMetricNotFound
+			}
+			return err
+		}
+
 		return ctx.Commit()
 	})
 	return
@@ -51,9 +70,15 @@ func (s *Service) GetMetricByID(
 func (s *Service) ListMetricByTrainee(
 	ctx context.Context,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
+	subject authz.Subject,
 	traineeId string,
 ) (m []*metric.Metric, outErr error) {
 	outErr = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		resource := authz.Trainee(traineeId)
+		if err := ctx.Policy.Authorize(ctx.Context(), subject, authz.ActionReadMetrics, resource); err != nil {
+			return err
+		}
+
 		var err error
 		if m, err = ctx.MetricStorage.ListByTrainee(ctx.Context(), traineeId); err != nil {
 			return err
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	groupstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/groups"
 	metricstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/metrics"
+	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/app/authz"
 	"github.com/burenotti/go_health_backend/internal/domain"
 	"github.com/burenotti/go_health_backend/internal/domain/metric"
 )
@@ -22,6 +25,7 @@ type AtomicContext struct {
 	ctx           context.Context
 	db            storage.DBContext
 	MetricStorage MetricStorage
+	Policy        *authz.Policy
 }
 
 func (a *AtomicContext) Context() context.Context {
@@ -53,5 +57,9 @@ func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*Atomic
 		ctx:           ctx,
 		db:            dbContext,
 		MetricStorage: metricstorage.NewPostgresStorage(dbContext),
+		Policy: authz.New(
+			profilestorage.NewPostgresStorage(dbContext),
+			groupstorage.NewPostgresStorage(dbContext, nil),
+		),
 	}, nil
 }
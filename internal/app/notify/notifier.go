@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/mail"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, msg mail.Message) error
+}
+
+type Tokens interface {
+	EmailVerificationToken(userId string, email string) (string, error)
+	PasswordResetToken(ctx context.Context, resetId string) (string, error)
+	EmailChangeTokens(changeId string, userId string, expiresAt time.Time, undoUntil time.Time) (string, string, error)
+}
+
+type Notifier struct {
+	mailer    Mailer
+	tokens    Tokens
+	publicURL string
+	logger    *slog.Logger
+}
+
+func New(mailer Mailer, tokens Tokens, publicURL string, logger *slog.Logger) *Notifier {
+	return &Notifier{
+		mailer:    mailer,
+		tokens:    tokens,
+		publicURL: publicURL,
+		logger:    logger,
+	}
+}
+
+func (n *Notifier) OnUserCreated(event domain.Event) error {
+	switch e := event.(type) {
+	case *auth.CreatedEvent:
+		return n.sendVerification(e.UserID, e.Email)
+	case auth.CreatedEvent:
+		return n.sendVerification(e.UserID, e.Email)
+	}
+	return nil
+}
+
+func (n *Notifier) OnEmailVerificationRequested(event domain.Event) error {
+	if e, ok := event.(auth.EmailVerificationRequestedEvent); ok {
+		return n.sendVerification(e.UserID, e.Email)
+	}
+	return nil
+}
+
+func (n *Notifier) sendVerification(userId, email string) error {
+	token, err := n.tokens.EmailVerificationToken(userId, email)
+	if err != nil {
+		return err
+	}
+
+	link := n.link("/verify-email", url.Values{"token": {token}})
+	return n.send(mail.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf(
+			"Welcome! Please confirm your email address by following the link:\n%s",
+			link,
+		),
+	})
+}
+
+func (n *Notifier) OnPasswordResetRequested(event domain.Event) error {
+	e, ok := event.(auth.PasswordResetRequestedEvent)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	token, err := n.tokens.PasswordResetToken(ctx, e.ResetID)
+	if err != nil {
+		return err
+	}
+
+	link := n.link("/reset-password", url.Values{"token": {token}})
+	return n.send(mail.Message{
+		To:      e.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Someone requested a password reset for your account.\n\n"+
+				"Follow the link to choose a new password:\n%s\n\n"+
+				"The link is valid until %s. If it wasn't you, just ignore this message.",
+			link, e.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+func (n *Notifier) OnEmailChangeRequested(event domain.Event) error {
+	e, ok := event.(auth.EmailChangeRequestedEvent)
+	if !ok {
+		return nil
+	}
+
+	confirmToken, undoToken, err := n.tokens.EmailChangeTokens(e.ChangeID, e.UserID, e.ExpiresAt, e.UndoUntil)
+	if err != nil {
+		return err
+	}
+
+	confirm := n.link("/confirm-email-change", url.Values{"token": {confirmToken}})
+	err = n.send(mail.Message{
+		To:      e.NewEmail,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf(
+			"Follow the link to use this address for your account:\n%s\n\n"+
+				"The link is valid until %s. If it wasn't you, just ignore this message.",
+			confirm, e.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	undo := n.link("/revert-email-change", url.Values{"token": {undoToken}})
+	return n.send(mail.Message{
+		To:      e.OldEmail,
+		Subject: "Your email is being changed",
+		Body: fmt.Sprintf(
+			"Someone asked to change the email of your account to %s.\n\n"+
+				"If it wasn't you, follow the link to keep this address and log out everywhere:\n%s\n\n"+
+				"The link is valid until %s.",
+			e.NewEmail, undo, e.UndoUntil.Format(time.RFC1123),
+		),
+	})
+}
+
+func (n *Notifier) OnMagicLinkRequested(event domain.Event) error {
+	e, ok := event.(auth.MagicLinkRequestedEvent)
+	if !ok {
+		return nil
+	}
+
+	link := n.link("/magic-link", url.Values{"token": {e.Token}})
+	return n.send(mail.Message{
+		To:      e.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf(
+			"Follow the link to log in:\n%s\n\n"+
+				"Open it on the same device and in the same browser you requested it from (%s, %s). "+
+				"The link can be used once and is valid until %s.\n\n"+
+				"If it wasn't you, just ignore this message.",
+			link, e.Device.Browser, e.Device.OS, e.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+func (n *Notifier) OnNewDeviceLogin(event domain.Event) error {
+	e, ok := event.(auth.NewDeviceLoginEvent)
+	if !ok {
+		return nil
+	}
+
+	return n.send(mail.Message{
+		To:      e.Email,
+		Subject: "New login to your account",
+		Body: fmt.Sprintf(
+			"Your account was just accessed from a new device:\n\n"+
+				"Browser: %s\nOS: %s\nIP address: %s\nTime: %s\n\n"+
+				"If it wasn't you, change your password and end the session in the account settings.",
+			e.Device.Browser, e.Device.OS, e.Device.IPAddress, e.At.Format(time.RFC1123),
+		),
+	})
+}
+
+func (n *Notifier) link(path string, query url.Values) string {
+	return n.publicURL + path + "?" + query.Encode()
+}
+
+func (n *Notifier) send(msg mail.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return n.mailer.Send(ctx, msg)
+}
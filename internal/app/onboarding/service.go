@@ -0,0 +1,68 @@
+package onboardingapp
+
+import (
+	"context"
+	"github.com/burenotti/go_health_backend/internal/app/authapp"
+	profileapp "github.com/burenotti/go_health_backend/internal/app/profile"
+	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+	"github.com/burenotti/go_health_backend/internal/domain/profile"
+	"log/slog"
+)
+
+// Service signs users up together with their profile, so no account is
+// left without one.
+type Service struct {
+	logger *slog.Logger
+	auth   *authapp.Service
+}
+
+func New(authService *authapp.Service, logger *slog.Logger) *Service {
+	return &Service{
+		logger: logger,
+		auth:   authService,
+	}
+}
+
+type SignUpResult struct {
+	Tokens  authapp.Tokens
+	Profile profile.Profile
+}
+
+// SignUp creates the user and the profile in one transaction and logs the
+// user in. Tokens are empty if login requires a verified email.
+func (s *Service) SignUp(
+	ctx context.Context,
+	uow *unitofwork.UnitOfWork[*AtomicContext],
+	device auth.Device,
+	userId string,
+	email string,
+	password string,
+	profileType string,
+	fields profile.Patch,
+) (res SignUpResult, err error) {
+	u, err := s.auth.NewUser(userId, email, password)
+	if err != nil {
+		return res, err
+	}
+
+	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
+		tokens, err := s.auth.StartSession(u, device)
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.UserStorage.Add(ctx.Context(), u); err != nil {
+			return err
+		}
+
+		p, err := profileapp.AddProfile(ctx.Context(), ctx.ProfileStorage, userId, profileType, fields)
+		if err != nil {
+			return err
+		}
+
+		res = SignUpResult{Tokens: tokens, Profile: p}
+		return ctx.Commit()
+	})
+	return
+}
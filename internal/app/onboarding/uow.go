@@ -0,0 +1,97 @@
+package onboardingapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage"
+	auditstorage "github.com/burenotti/go_health_backend/internal/adapter/storage/audit"
+	profilestorage "github.com/burenotti/go_health_backend/internal/adapter/storage/profiles"
+	"github.com/burenotti/go_health_backend/internal/adapter/storage/userstorage"
+	auditapp "github.com/burenotti/go_health_backend/internal/app/audit"
+	profileapp "github.com/burenotti/go_health_backend/internal/app/profile"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/burenotti/go_health_backend/internal/domain/audit"
+	"github.com/burenotti/go_health_backend/internal/domain/auth"
+)
+
+type UserStorage interface {
+	Add(ctx context.Context, u *auth.User) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AuditStorage interface {
+	Add(ctx context.Context, e *audit.Entry) error
+	CollectEvents() []domain.Event
+	Close() error
+}
+
+type AtomicContext struct {
+	ctx context.Context
+	storage.DBContext
+	UserStorage    UserStorage
+	ProfileStorage profileapp.ProfileStorage
+	AuditStorage   AuditStorage
+
+	events []domain.Event
+}
+
+func (a *AtomicContext) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AtomicContext) Commit() error {
+	events := a.collectEvents()
+	a.events = append(a.events, events...)
+	if err := auditapp.RecordEvents(a.ctx, a.AuditStorage, events); err != nil {
+		return err
+	}
+	return a.DBContext.Commit()
+}
+
+func (a *AtomicContext) Close() (err error) {
+	if closeErr := a.UserStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.ProfileStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if closeErr := a.AuditStorage.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		err = errors.Join(fmt.Errorf("failed to close storage"), err)
+	}
+
+	return err
+}
+
+func (a *AtomicContext) CollectEvents() []domain.Event {
+	events := append(a.events, a.collectEvents()...)
+	a.events = nil
+	return events
+}
+
+func (a *AtomicContext) collectEvents() []domain.Event {
+	userEvents := a.UserStorage.CollectEvents()
+	profileEvents := a.ProfileStorage.CollectEvents()
+
+	events := make([]domain.Event, 0, len(userEvents)+len(profileEvents))
+	events = append(events, userEvents...)
+	events = append(events, profileEvents...)
+	return events
+}
+
+func NewAtomicContext(ctx context.Context, dbContext storage.DBContext) (*AtomicContext, error) {
+	return &AtomicContext{
+		ctx:            ctx,
+		DBContext:      dbContext,
+		UserStorage:    userstorage.NewPostgresStorage(dbContext, nil),
+		ProfileStorage: profilestorage.NewPostgresStorage(dbContext),
+		AuditStorage:   auditstorage.NewPostgresStorage(dbContext),
+	}, nil
+}
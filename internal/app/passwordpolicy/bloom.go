@@ -0,0 +1,124 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid bloom filter file")
+)
+
+const (
+	filterMagic   = "GHBF"
+	filterVersion = 1
+)
+
+// BloomFilter is a probabilistic set of SHA-1 password hashes, the format
+// breached password corpora are distributed in. Lookups never miss a
+// breached password and report a clean one as breached with the false
+// positive rate the filter was built for.
+//
+// The file starts with the "GHBF" magic, a version byte, the number of hash
+// functions as a byte and the number of bits as a big endian uint64,
+// followed by the bits.
+type BloomFilter struct {
+	k    uint8
+	m    uint64
+	bits []byte
+}
+
+// NewBloomFilter sizes the filter for n hashes at the false positive rate.
+func NewBloomFilter(n uint64, falsePositiveRate float64) *BloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 8)
+	k := uint8(max(1, math.Round(float64(m)/float64(max(n, 1))*math.Ln2)))
+
+	return &BloomFilter{
+		k:    k,
+		m:    m,
+		bits: make([]byte, (m+7)/8),
+	}
+}
+
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var header [len(filterMagic) + 2 + 8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+	}
+
+	if string(header[:4]) != filterMagic || header[4] != filterVersion {
+		return nil, ErrInvalidFilter
+	}
+
+	f := &BloomFilter{
+		k: header[5],
+		m: binary.BigEndian.Uint64(header[6:]),
+	}
+	if f.k == 0 || f.m == 0 {
+		return nil, ErrInvalidFilter
+	}
+
+	f.bits = make([]byte, (f.m+7)/8)
+	if _, err := io.ReadFull(r, f.bits); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+	}
+	return f, nil
+}
+
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var header [len(filterMagic) + 2 + 8]byte
+	copy(header[:], filterMagic)
+	header[4] = filterVersion
+	header[5] = f.k
+	binary.BigEndian.PutUint64(header[6:], f.m)
+
+	n, err := w.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+
+	written, err := w.Write(f.bits)
+	return int64(n + written), err
+}
+
+func (f *BloomFilter) Add(sum [sha1.Size]byte) {
+	for i := uint8(0); i < f.k; i++ {
+		bit := f.index(sum, i)
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (f *BloomFilter) Contains(sum [sha1.Size]byte) bool {
+	for i := uint8(0); i < f.k; i++ {
+		bit := f.index(sum, i)
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *BloomFilter) ContainsPassword(password string) bool {
+	return f.Contains(sha1.Sum([]byte(password)))
+}
+
+// index derives the i-th bit position from the hash by double hashing.
+func (f *BloomFilter) index(sum [sha1.Size]byte, i uint8) uint64 {
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+	return (h1 + uint64(i)*h2) % f.m
+}
@@ -0,0 +1,155 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrWeakPassword = errors.New("password does not meet the policy")
+)
+
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleStrength  = "strength"
+	RuleBreached  = "breached"
+	RuleEmail     = "contains_email"
+)
+
+type Input struct {
+	Password string
+	Email    string
+}
+
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Error lists every rule the password broke.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	return ErrWeakPassword.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return ErrWeakPassword
+}
+
+type Rule interface {
+	Check(in Input) *Violation
+}
+
+type Policy struct {
+	rules []Rule
+}
+
+func New(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Default is used when no policy is configured.
+func Default() *Policy {
+	return New(
+		Length{Min: 8, Max: 128},
+		NoEmail{},
+		Strength{MinScore: 2},
+	)
+}
+
+// Validate returns *Error when the password breaks any of the rules.
+func (p *Policy) Validate(password, email string) error {
+	if p == nil {
+		return nil
+	}
+
+	in := Input{Password: password, Email: email}
+	var violations []Violation
+	for _, r := range p.rules {
+		if v := r.Check(in); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+
+	if len(violations) != 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+type Length struct {
+	Min int
+	Max int
+}
+
+func (l Length) Check(in Input) *Violation {
+	n := utf8.RuneCountInString(in.Password)
+	if n < l.Min {
+		return &Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("password must be at least %d characters long", l.Min),
+		}
+	}
+	if l.Max > 0 && n > l.Max {
+		return &Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("password must be at most %d characters long", l.Max),
+		}
+	}
+	return nil
+}
+
+// NoEmail rejects passwords containing the local part of the email.
+type NoEmail struct{}
+
+func (NoEmail) Check(in Input) *Violation {
+	local, _, _ := strings.Cut(strings.ToLower(in.Email), "@")
+	if utf8.RuneCountInString(local) < 3 {
+		return nil
+	}
+
+	if strings.Contains(strings.ToLower(in.Password), local) {
+		return &Violation{
+			Rule:    RuleEmail,
+			Message: "password must not contain the email address",
+		}
+	}
+	return nil
+}
+
+// Strength requires the estimated Score to be at least MinScore.
+type Strength struct {
+	MinScore int
+}
+
+func (s Strength) Check(in Input) *Violation {
+	local, _, _ := strings.Cut(in.Email, "@")
+	if Score(in.Password, local) < s.MinScore {
+		return &Violation{
+			Rule:    RuleStrength,
+			Message: "password is too easy to guess",
+		}
+	}
+	return nil
+}
+
+// Breached rejects passwords found in the breached passwords filter.
+type Breached struct {
+	Filter *BloomFilter
+}
+
+func (b Breached) Check(in Input) *Violation {
+	if b.Filter != nil && b.Filter.ContainsPassword(in.Password) {
+		return &Violation{
+			Rule:    RuleBreached,
+			Message: "password has appeared in a data breach",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is ordered by popularity; the rank of a match is used as
+// the number of guesses needed to find it.
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "login",
+	"abc123", "monkey", "dragon", "football", "baseball", "iloveyou",
+	"master", "sunshine", "princess", "shadow", "superman", "trustno",
+	"michael", "jennifer", "hunter", "freedom", "whatever", "qazwsx",
+	"starwars", "batman", "passw", "secret", "summer", "winter", "spring",
+	"autumn", "hello", "charlie", "donald", "soccer", "hockey", "killer",
+	"george", "pepper", "jordan", "harley", "ranger", "thomas", "robert",
+	"daniel", "andrew", "joshua", "matthew", "jessica", "ashley", "amanda",
+	"nicole", "buster", "tigger", "ginger", "cookie", "cheese", "orange",
+	"banana", "flower", "purple", "yellow", "silver", "golden", "diamond",
+	"computer", "internet", "google", "samsung", "apple", "london", "love",
+	"lovely", "angel", "family", "friend", "health", "fitness", "coach",
+	"trainer", "workout", "running", "weight", "strong", "power", "energy",
+	"change", "access", "default", "guest", "root", "test", "user", "pass",
+	"mypass", "zaq12wsx", "asdf", "zxcv", "blink", "matrix", "mustang",
+	"corvette", "ferrari", "yankees", "lakers", "chelsea", "arsenal",
+	"liverpool", "barcelona", "madrid", "forever", "happy", "lucky",
+	"qwertyuiop", "asdfghjkl", "zxcvbnm", "1q2w3e4r", "1qaz2wsx",
+}
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+var leet = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i',
+	'!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't',
+	'2': 'z',
+}
+
+type match struct {
+	length  int
+	guesses float64
+}
+
+// Score estimates how hard the password is to guess on the zxcvbn scale:
+//
+//	0 - fewer than 10^3 guesses
+//	1 - fewer than 10^6 guesses
+//	2 - fewer than 10^8 guesses
+//	3 - fewer than 10^10 guesses
+//	4 - more
+//
+// The password is split into the cheapest sequence of common passwords,
+// user specific words, repeats, sequences and keyboard walks; what is left
+// is counted as brute force over its character classes.
+func Score(password string, userInputs ...string) int {
+	guesses := estimateGuesses(password, userInputs)
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	}
+	return 4
+}
+
+func estimateGuesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 1
+	}
+
+	lower := []rune(strings.ToLower(password))
+	plain := make([]rune, len(lower))
+	for i, r := range lower {
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+		plain[i] = r
+	}
+
+	dictionary := commonPasswords
+	for _, w := range userInputs {
+		if w = strings.ToLower(w); len(w) >= 3 {
+			dictionary = append([]string{w}, dictionary...)
+		}
+	}
+
+	cardinality := bruteforceCardinality(runes)
+	guesses := 1.0
+	segments := 0
+
+	for i := 0; i < len(runes); {
+		best := match{length: 1, guesses: cardinality}
+		for _, m := range []match{
+			dictionaryMatch(runes, lower, plain, i, dictionary),
+			repeatMatch(runes, i),
+			sequenceMatch(runes, i),
+			keyboardMatch(lower, i),
+		} {
+			if m.length > best.length || (m.length == best.length && m.guesses < best.guesses) {
+				best = m
+			}
+		}
+
+		guesses *= best.guesses
+		segments++
+		i += best.length
+	}
+
+	// The attacker also has to guess how the password is composed.
+	return guesses * math.Gamma(float64(segments)+1)
+}
+
+func bruteforceCardinality(runes []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	c := 0.0
+	if lower {
+		c += 26
+	}
+	if upper {
+		c += 26
+	}
+	if digit {
+		c += 10
+	}
+	if symbol {
+		c += 33
+	}
+	if other {
+		c += 100
+	}
+	return c
+}
+
+// dictionaryMatch looks for a word at i as typed and with leet
+// substitutions undone.
+func dictionaryMatch(runes, lower, plain []rune, i int, dictionary []string) match {
+	best := match{}
+	typed, unleeted := string(lower[i:]), string(plain[i:])
+	for rank, word := range dictionary {
+		n := len([]rune(word))
+		if n < 3 || n <= best.length {
+			continue
+		}
+
+		guesses := float64(rank + 1)
+		switch {
+		case strings.HasPrefix(typed, word):
+		case strings.HasPrefix(unleeted, word):
+			guesses *= 2
+		default:
+			continue
+		}
+
+		for _, r := range runes[i : i+n] {
+			if unicode.IsUpper(r) {
+				guesses *= 2
+				break
+			}
+		}
+		best = match{length: n, guesses: guesses}
+	}
+	return best
+}
+
+func repeatMatch(runes []rune, i int) match {
+	n := 1
+	for i+n < len(runes) && runes[i+n] == runes[i] {
+		n++
+	}
+	if n < 3 {
+		return match{}
+	}
+	return match{length: n, guesses: bruteforceCardinality(runes[i:i+1]) * float64(n)}
+}
+
+func sequenceMatch(runes []rune, i int) match {
+	if i+2 >= len(runes) {
+		return match{}
+	}
+
+	delta := runes[i+1] - runes[i]
+	if delta != 1 && delta != -1 {
+		return match{}
+	}
+
+	n := 2
+	for i+n < len(runes) && runes[i+n]-runes[i+n-1] == delta {
+		n++
+	}
+	if n < 3 {
+		return match{}
+	}
+
+	base := 26.0
+	switch runes[i] {
+	case 'a', 'A', 'z', 'Z', '0', '1', '9':
+		base = 4
+	default:
+		if unicode.IsDigit(runes[i]) {
+			base = 10
+		}
+	}
+	return match{length: n, guesses: base * float64(n)}
+}
+
+func keyboardMatch(plain []rune, i int) match {
+	best := match{}
+	for _, row := range keyboardRows {
+		for _, r := range []string{row, reverse(row)} {
+			n := 0
+			for i+n < len(plain) {
+				if n > 0 {
+					idx := strings.IndexRune(r, plain[i+n-1])
+					if idx < 0 || idx+1 >= len(r) || rune(r[idx+1]) != plain[i+n] {
+						break
+					}
+				} else if !strings.ContainsRune(r, plain[i]) {
+					break
+				}
+				n++
+			}
+			if n >= 4 && n > best.length {
+				best = match{length: n, guesses: 20 * float64(n)}
+			}
+		}
+	}
+	return best
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
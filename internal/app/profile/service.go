@@ -2,6 +2,7 @@ package profileapp
 
 import (
 	"context"
+	"errors"
 	"github.com/burenotti/go_health_backend/internal/app/unitofwork"
 	"github.com/burenotti/go_health_backend/internal/domain/profile"
 	"log/slog"
@@ -20,54 +21,89 @@ func New(
 	}
 }
 
-func (s *Service) CreateTrainee(
+// CreateProfile creates the only profile of the user. A user is either a
+// trainee or a coach, never both.
+func (s *Service) CreateProfile(
 	ctx context.Context,
 	userID string,
-	firstName string,
-	lastName string,
-	birthDate *time.Time,
+	profileType string,
+	fields profile.Patch,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
-) (trainee *profile.Trainee, err error) {
+) (p profile.Profile, err error) {
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		trainee = profile.NewTrainee(userID, firstName, lastName, birthDate)
-		if err := ctx.ProfileStorage.Add(ctx.Context(), trainee); err != nil {
+		var err error
+		p, err = AddProfile(ctx.Context(), ctx.ProfileStorage, userID, profileType, fields)
+		if err != nil {
 			return err
 		}
-
 		return ctx.Commit()
 	})
 	return
 }
 
-func (s *Service) CreateCoach(
+// AddProfile creates the profile in the storage of a transaction the
+// caller owns.
+func AddProfile(
+	ctx context.Context,
+	storage ProfileStorage,
+	userID string,
+	profileType string,
+	fields profile.Patch,
+) (profile.Profile, error) {
+	_, err := storage.GetByID(ctx, userID)
+	if err == nil {
+		return nil, profile.ErrProfileExists
+	}
+	if !errors.Is(err, profile.ErrProfileNotFound) {
+		return nil, err
+	}
+
+	p, err := profile.New(userID, profileType, fields, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Add(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Service) GetProfileByID(
 	ctx context.Context,
 	userID string,
-	firstName string,
-	lastName string,
-	birthDate *time.Time,
-	yearsExperience int,
-	bio string,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
-) (coach *profile.Coach, err error) {
+) (p profile.Profile, err error) {
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
-		coach = profile.NewCoach(userID, firstName, lastName, birthDate, yearsExperience, bio)
-		if err := ctx.ProfileStorage.Add(ctx.Context(), coach); err != nil {
-			return err
-		}
-		return ctx.Commit()
+		var err error
+		p, err = ctx.ProfileStorage.GetByID(ctx.Context(), userID)
+		return err
 	})
 	return
 }
 
-func (s *Service) GetProfileByID(
+// UpdateProfile applies a partial update to the profile of the user,
+// whichever type it is.
+func (s *Service) UpdateProfile(
 	ctx context.Context,
 	userID string,
+	patch profile.Patch,
 	uow *unitofwork.UnitOfWork[*AtomicContext],
 ) (p profile.Profile, err error) {
 	err = uow.Atomic(ctx, func(ctx *AtomicContext) error {
 		var err error
 		p, err = ctx.ProfileStorage.GetByID(ctx.Context(), userID)
-		return err
+		if err != nil {
+			return err
+		}
+
+		if err := p.Update(patch, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		if err := ctx.ProfileStorage.Persist(ctx.Context(), p); err != nil {
+			return err
+		}
+		return ctx.Commit()
 	})
 	return
 }
@@ -17,6 +17,7 @@ type AtomicContext struct {
 type ProfileStorage interface {
 	Add(ctx context.Context, profile profile.Profile) error
 	GetByID(ctx context.Context, userId string) (profile.Profile, error)
+	Persist(ctx context.Context, profile profile.Profile) error
 	CollectEvents() []domain.Event
 	Close() error
 }
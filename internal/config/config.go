@@ -26,16 +26,80 @@ func (e *Environment) SetValue(s string) error {
 	return nil
 }
 
+type MailDriver string
+
+const (
+	MailDriverSMTP MailDriver = "smtp"
+	MailDriverLog  MailDriver = "log"
+)
+
+func (d *MailDriver) SetValue(s string) error {
+	*d = MailDriver(s)
+	if *d != MailDriverSMTP && *d != MailDriverLog {
+		return configNotLoadedErr(`only "smtp" and "log" mail drivers are allowed`)
+	}
+	return nil
+}
+
+type TokenTransport string
+
+const (
+	TokenTransportHeader TokenTransport = "header"
+	TokenTransportCookie TokenTransport = "cookie"
+	TokenTransportBoth   TokenTransport = "both"
+)
+
+func (t *TokenTransport) SetValue(s string) error {
+	*t = TokenTransport(s)
+	if *t != TokenTransportHeader && *t != TokenTransportCookie && *t != TokenTransportBoth {
+		return configNotLoadedErr(`only "header", "cookie" and "both" token transports are allowed`)
+	}
+	return nil
+}
+
+type SameSite string
+
+const (
+	SameSiteStrict SameSite = "strict"
+	SameSiteLax    SameSite = "lax"
+	SameSiteNone   SameSite = "none"
+)
+
+func (m *SameSite) SetValue(s string) error {
+	*m = SameSite(s)
+	if *m != SameSiteStrict && *m != SameSiteLax && *m != SameSiteNone {
+		return configNotLoadedErr(`only "strict", "lax" and "none" same site modes are allowed`)
+	}
+	return nil
+}
+
+type OIDCProvider struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+}
+
 type Config struct {
 	App struct {
-		Env Environment `yaml:"env" env:"ENV" env-required:""`
+		Env       Environment `yaml:"env" env:"ENV" env-required:""`
+		PublicURL string      `yaml:"public_url" env:"PUBLIC_URL" env-default:"http://localhost:8080"`
 	} `yaml:"app" env-prefix:"APP_" env-required:""`
 
 	Server struct {
 		Host string `yaml:"host" env:"HOST" env-default:"localhost"`
 		Port int    `yaml:"port" env:"PORT" env-default:"8080"`
+
+		// TrustedProxies lists the networks of reverse proxies whose
+		// Forwarded and X-Forwarded-For headers are honored.
+		TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
 	} `yaml:"server" env-prefix:"SERVER_"`
 
+	Geo struct {
+		ASNDatabaseFile string `yaml:"asn_database_file" env:"ASN_DATABASE_FILE"`
+	} `yaml:"geo" env-prefix:"GEO_"`
+
 	DB struct {
 		DSN string `yaml:"dsn" env:"DB_DSN" env-required:""`
 	} `yaml:"db" env-prefix:"DB_" env-required:""`
@@ -43,8 +107,130 @@ type Config struct {
 	JWT struct {
 		AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" env-default:"2h"`
 		RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" env-default:"24h"`
-		Secret          string        `yaml:"secret" env:"SECRET" env-required:""`
+		Secret          string        `yaml:"secret" env:"SECRET"`
+
+		Algorithm        string            `yaml:"algorithm" env:"ALGORITHM" env-default:"HS256"`
+		KeyID            string            `yaml:"key_id" env:"KEY_ID"`
+		PrivateKeyFile   string            `yaml:"private_key_file" env:"PRIVATE_KEY_FILE"`
+		VerificationKeys map[string]string `yaml:"verification_keys" env:"VERIFICATION_KEYS"`
+		// AcceptLegacyHMAC keeps tokens signed with Secret valid after
+		// switching to an asymmetric algorithm. Disable once they expire.
+		AcceptLegacyHMAC bool `yaml:"accept_legacy_hmac" env:"ACCEPT_LEGACY_HMAC"`
+
+		// Revocation is eventually consistent: every instance caches that an
+		// authorization is alive for RevocationCacheTTL, so its access tokens
+		// keep working there for up to that long after a logout made
+		// elsewhere.
+		RevocationCacheSize int           `yaml:"revocation_cache_size" env:"REVOCATION_CACHE_SIZE" env-default:"10000"`
+		RevocationCacheTTL  time.Duration `yaml:"revocation_cache_ttl" env:"REVOCATION_CACHE_TTL" env-default:"5s"`
 	} `yaml:"jwt" env-prefix:"JWT_" env-required:""`
+
+	Auth struct {
+		LinkSecret       string        `yaml:"link_secret" env:"LINK_SECRET" env-required:""`
+		PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" env-default:"1h"`
+
+		PasswordPolicy struct {
+			MinLength          int    `yaml:"min_length" env:"MIN_LENGTH" env-default:"8"`
+			MaxLength          int    `yaml:"max_length" env:"MAX_LENGTH" env-default:"128"`
+			MinScore           int    `yaml:"min_score" env:"MIN_SCORE" env-default:"2"`
+			BreachedFilterFile string `yaml:"breached_filter_file" env:"BREACHED_FILTER_FILE"`
+		} `yaml:"password_policy" env-prefix:"PASSWORD_POLICY_"`
+
+		Argon2 struct {
+			Memory      uint32 `yaml:"memory" env:"MEMORY" env-default:"65536"`
+			Iterations  uint32 `yaml:"iterations" env:"ITERATIONS" env-default:"3"`
+			Parallelism uint8  `yaml:"parallelism" env:"PARALLELISM" env-default:"2"`
+		} `yaml:"argon2" env-prefix:"ARGON2_"`
+
+		EmailVerification struct {
+			TTL              time.Duration `yaml:"ttl" env:"TTL" env-default:"48h"`
+			RequiredForLogin bool          `yaml:"required_for_login" env:"REQUIRED_FOR_LOGIN" env-default:"false"`
+			RequiredRoutes   []string      `yaml:"required_routes" env:"REQUIRED_ROUTES"`
+		} `yaml:"email_verification" env-prefix:"EMAIL_VERIFICATION_"`
+
+		MFA struct {
+			Issuer       string        `yaml:"issuer" env:"ISSUER" env-default:"GoHealth"`
+			ChallengeTTL time.Duration `yaml:"challenge_ttl" env:"CHALLENGE_TTL" env-default:"5m"`
+			// SecretKey is the base64 encoded 32 byte key TOTP secrets are
+			// encrypted with.
+			SecretKey string `yaml:"secret_key" env:"SECRET_KEY" env-required:""`
+		} `yaml:"mfa" env-prefix:"MFA_"`
+
+		Lockout struct {
+			Account struct {
+				MaxFailures  int           `yaml:"max_failures" env:"MAX_FAILURES" env-default:"5"`
+				Window       time.Duration `yaml:"window" env:"WINDOW" env-default:"15m"`
+				LockDuration time.Duration `yaml:"lock_duration" env:"LOCK_DURATION" env-default:"15m"`
+				BaseDelay    time.Duration `yaml:"base_delay" env:"BASE_DELAY" env-default:"1s"`
+				MaxDelay     time.Duration `yaml:"max_delay" env:"MAX_DELAY" env-default:"30s"`
+			} `yaml:"account" env-prefix:"ACCOUNT_"`
+
+			Address struct {
+				MaxFailures  int           `yaml:"max_failures" env:"MAX_FAILURES" env-default:"50"`
+				Window       time.Duration `yaml:"window" env:"WINDOW" env-default:"1h"`
+				LockDuration time.Duration `yaml:"lock_duration" env:"LOCK_DURATION" env-default:"1h"`
+				BaseDelay    time.Duration `yaml:"base_delay" env:"BASE_DELAY" env-default:"0s"`
+				MaxDelay     time.Duration `yaml:"max_delay" env:"MAX_DELAY" env-default:"0s"`
+			} `yaml:"address" env-prefix:"ADDRESS_"`
+		} `yaml:"lockout" env-prefix:"LOCKOUT_"`
+
+		EmailChange struct {
+			TTL     time.Duration `yaml:"ttl" env:"TTL" env-default:"24h"`
+			UndoTTL time.Duration `yaml:"undo_ttl" env:"UNDO_TTL" env-default:"168h"`
+		} `yaml:"email_change" env-prefix:"EMAIL_CHANGE_"`
+
+		// Session controls how tokens travel between the server and clients:
+		// in the Authorization header, in cookies or both.
+		Session struct {
+			Transport      TokenTransport `yaml:"transport" env:"TRANSPORT" env-default:"header"`
+			CookieDomain   string         `yaml:"cookie_domain" env:"COOKIE_DOMAIN"`
+			CookieSecure   bool           `yaml:"cookie_secure" env:"COOKIE_SECURE" env-default:"true"`
+			CookieSameSite SameSite       `yaml:"cookie_same_site" env:"COOKIE_SAME_SITE" env-default:"strict"`
+		} `yaml:"session" env-prefix:"SESSION_"`
+
+		MagicLink struct {
+			TTL time.Duration `yaml:"ttl" env:"TTL" env-default:"15m"`
+
+			// Requests limits the links requested per client address and
+			// per email within Window.
+			Requests struct {
+				PerAddress int           `yaml:"per_address" env:"PER_ADDRESS" env-default:"30"`
+				PerEmail   int           `yaml:"per_email" env:"PER_EMAIL" env-default:"5"`
+				Window     time.Duration `yaml:"window" env:"WINDOW" env-default:"1h"`
+			} `yaml:"requests" env-prefix:"REQUESTS_"`
+		} `yaml:"magic_link" env-prefix:"MAGIC_LINK_"`
+
+		OIDC struct {
+			StateTTL  time.Duration           `yaml:"state_ttl" env:"STATE_TTL" env-default:"10m"`
+			Providers map[string]OIDCProvider `yaml:"providers"`
+		} `yaml:"oidc" env-prefix:"OIDC_"`
+	} `yaml:"auth" env-prefix:"AUTH_"`
+
+	Account struct {
+		DeletionGracePeriod time.Duration `yaml:"deletion_grace_period" env:"DELETION_GRACE_PERIOD" env-default:"720h"`
+		PurgeInterval       time.Duration `yaml:"purge_interval" env:"PURGE_INTERVAL" env-default:"1h"`
+	} `yaml:"account" env-prefix:"ACCOUNT_"`
+
+	Export struct {
+		TTL time.Duration `yaml:"ttl" env:"TTL" env-default:"24h"`
+	} `yaml:"export" env-prefix:"EXPORT_"`
+
+	Admin struct {
+		ImpersonationTTL time.Duration `yaml:"impersonation_ttl" env:"IMPERSONATION_TTL" env-default:"15m"`
+	} `yaml:"admin" env-prefix:"ADMIN_"`
+
+	Mail struct {
+		Driver  MailDriver `yaml:"driver" env:"DRIVER" env-default:"log"`
+		From    string     `yaml:"from" env:"FROM" env-default:"noreply@localhost"`
+		LogFile string     `yaml:"log_file" env:"LOG_FILE"`
+
+		SMTP struct {
+			Host     string `yaml:"host" env:"HOST" env-default:"localhost"`
+			Port     int    `yaml:"port" env:"PORT" env-default:"587"`
+			Username string `yaml:"username" env:"USERNAME"`
+			Password string `yaml:"password" env:"PASSWORD"`
+		} `yaml:"smtp" env-prefix:"SMTP_"`
+	} `yaml:"mail" env-prefix:"MAIL_"`
 }
 
 func Load(filePath string) (*Config, error) {
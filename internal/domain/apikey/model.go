@@ -0,0 +1,133 @@
+package apikey
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"github.com/samber/lo"
+	"time"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("api key not found")
+	ErrKeyRevoked   = errors.New("api key is revoked")
+	ErrInvalidScope = errors.New("invalid api key scope")
+)
+
+const (
+	EventCreated = "api_key.created"
+	EventRevoked = "api_key.revoked"
+)
+
+const (
+	ScopeMetricsWrite = "metrics:write"
+	ScopeMetricsRead  = "metrics:read"
+)
+
+var Scopes = []string{ScopeMetricsWrite, ScopeMetricsRead}
+
+// touchInterval limits how often the last use of a key is written back.
+const touchInterval = time.Minute
+
+// APIKey is a long-lived credential for device integrations. Only the hash
+// of the secret is stored; the prefix lets the owner tell keys apart.
+type APIKey struct {
+	domain.Aggregate `diff:"-"`
+	KeyID            string     `diff:"-"`
+	UserID           string     `diff:"-"`
+	Name             string     `diff:"name"`
+	Prefix           string     `diff:"-"`
+	SecretHash       string     `diff:"-"`
+	Scopes           []string   `diff:"-"`
+	CreatedAt        time.Time  `diff:"-"`
+	LastUsedAt       *time.Time `diff:"last_used_at"`
+	RevokedAt        *time.Time `diff:"revoked_at"`
+}
+
+func New(keyID, userID, name, prefix, secretHash string, scopes []string) (*APIKey, error) {
+	if len(scopes) == 0 || !lo.Every(Scopes, scopes) {
+		return nil, ErrInvalidScope
+	}
+
+	k := &APIKey{
+		KeyID:      keyID,
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     lo.Uniq(scopes),
+		CreatedAt:  time.Now().UTC(),
+	}
+	k.PushEvent(CreatedEvent{
+		At:     k.CreatedAt,
+		KeyID:  k.KeyID,
+		UserID: k.UserID,
+		Scopes: k.Scopes,
+	})
+	return k, nil
+}
+
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return lo.Contains(k.Scopes, scope)
+}
+
+// Use records that the key was presented and reports whether the last use
+// changed enough to be stored.
+func (k *APIKey) Use(now time.Time) (bool, error) {
+	if !k.IsActive() {
+		return false, ErrKeyRevoked
+	}
+
+	if k.LastUsedAt != nil && now.Sub(*k.LastUsedAt) < touchInterval {
+		return false, nil
+	}
+	k.LastUsedAt = &now
+	return true, nil
+}
+
+func (k *APIKey) Revoke() error {
+	if !k.IsActive() {
+		return ErrKeyRevoked
+	}
+
+	now := time.Now().UTC()
+	k.RevokedAt = &now
+	k.PushEvent(RevokedEvent{
+		At:     now,
+		KeyID:  k.KeyID,
+		UserID: k.UserID,
+	})
+	return nil
+}
+
+type CreatedEvent struct {
+	At     time.Time
+	KeyID  string
+	UserID string
+	Scopes []string
+}
+
+func (e CreatedEvent) Type() string {
+	return EventCreated
+}
+
+func (e CreatedEvent) PublishedAt() time.Time {
+	return e.At
+}
+
+type RevokedEvent struct {
+	At     time.Time
+	KeyID  string
+	UserID string
+}
+
+func (e RevokedEvent) Type() string {
+	return EventRevoked
+}
+
+func (e RevokedEvent) PublishedAt() time.Time {
+	return e.At
+}
@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"time"
+)
+
+// Entry is a record of the security audit log. Entries are never removed;
+// purging an account only erases their personal data.
+type Entry struct {
+	EntryID int64
+	// UserID is the account the action was performed on.
+	UserID string
+	// ActorID is who performed the action. It equals UserID for the actions
+	// users perform on their own accounts.
+	ActorID     string
+	Action      string
+	IPAddress   string
+	Browser     string
+	OS          string
+	DeviceModel string
+	Details     map[string]string
+	CreatedAt   time.Time
+}
+
+type Filter struct {
+	UserID string
+	Action string
+	Limit  int
+	Offset int
+}
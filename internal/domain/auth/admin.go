@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrAccountLocked = errors.New("account is locked")
+	ErrInvalidRole   = errors.New("invalid role")
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u *User) SetRole(role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	if u.Role == role {
+		return nil
+	}
+
+	u.Role = role
+	u.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (u *User) IsLocked() bool {
+	return u.LockedAt != nil
+}
+
+// Lock blocks every way to log in until the account is unlocked and closes
+// the sessions that are already open.
+func (u *User) Lock() {
+	u.revokeAll()
+	if u.IsLocked() {
+		return
+	}
+
+	now := time.Now().UTC()
+	u.LockedAt = &now
+	u.UpdatedAt = now
+}
+
+func (u *User) Unlock() {
+	if !u.IsLocked() {
+		return
+	}
+
+	u.LockedAt = nil
+	u.UpdatedAt = time.Now().UTC()
+}
+
+// RevokeAllSessions closes every session of the user and returns how many
+// were open.
+func (u *User) RevokeAllSessions() int {
+	n := len(u.Sessions())
+	u.revokeAll()
+	return n
+}
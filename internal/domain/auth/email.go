@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"time"
+)
+
+var (
+	ErrEmailChangeInvalid = errors.New("email change link is invalid or expired")
+	ErrEmailUnchanged     = errors.New("new email is the same as the current one")
+)
+
+const (
+	EventEmailChangeRequested = "user.email_change_requested"
+	EventEmailChanged         = "user.email_changed"
+	EventEmailChangeReverted  = "user.email_change_reverted"
+)
+
+// EmailChange is a request to move the account to another address. It is
+// confirmed from the new address and can be undone from the old one until
+// UndoUntil, whether it was confirmed or not.
+type EmailChange struct {
+	domain.Aggregate `diff:"-"`
+	ChangeID         string     `diff:"-"`
+	UserID           string     `diff:"-"`
+	OldEmail         string     `diff:"-"`
+	NewEmail         string     `diff:"-"`
+	AuthorizationID  string     `diff:"-"`
+	CreatedAt        time.Time  `diff:"-"`
+	ExpiresAt        time.Time  `diff:"-"`
+	UndoUntil        time.Time  `diff:"-"`
+	ConfirmedAt      *time.Time `diff:"confirmed_at"`
+	RevertedAt       *time.Time `diff:"reverted_at"`
+}
+
+// RequestEmailChange starts moving the account to newEmail. The session
+// identified by authId survives the change.
+func (u *User) RequestEmailChange(
+	a Authorizer,
+	changeID string,
+	authID string,
+	r Reauthentication,
+	newEmail string,
+	ttl time.Duration,
+	undoTTL time.Duration,
+) (*EmailChange, error) {
+	if err := u.Reauthenticate(a, r); err != nil {
+		return nil, err
+	}
+
+	if newEmail == u.Email {
+		return nil, ErrEmailUnchanged
+	}
+
+	now := time.Now().UTC()
+	c := &EmailChange{
+		ChangeID:        changeID,
+		UserID:          u.UserID,
+		OldEmail:        u.Email,
+		NewEmail:        newEmail,
+		AuthorizationID: authID,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(ttl),
+		UndoUntil:       now.Add(undoTTL),
+	}
+	c.PushEvent(EmailChangeRequestedEvent{
+		At:        now,
+		ChangeID:  c.ChangeID,
+		UserID:    u.UserID,
+		OldEmail:  c.OldEmail,
+		NewEmail:  c.NewEmail,
+		ExpiresAt: c.ExpiresAt,
+		UndoUntil: c.UndoUntil,
+	})
+	return c, nil
+}
+
+// ConfirmEmailChange switches the account to the new address, which the
+// confirmation proves to be owned by the user, and closes every session
+// except the one the change was requested from.
+func (u *User) ConfirmEmailChange(c *EmailChange) error {
+	now := time.Now().UTC()
+	if c.UserID != u.UserID || c.ConfirmedAt != nil || c.RevertedAt != nil || now.After(c.ExpiresAt) {
+		return ErrEmailChangeInvalid
+	}
+	if u.Email != c.OldEmail {
+		return ErrEmailChangeInvalid
+	}
+
+	u.Email = c.NewEmail
+	u.VerifiedAt = &now
+	u.UpdatedAt = now
+	c.ConfirmedAt = &now
+
+	if current := u.GetAuthByID(c.AuthorizationID); current != nil {
+		for _, a := range u.Sessions() {
+			if a.FamilyID != current.FamilyID {
+				u.revokeFamily(a.FamilyID)
+			}
+		}
+	} else {
+		u.revokeAll()
+	}
+
+	u.PushEvent(EmailChangedEvent{
+		At:       now,
+		UserID:   u.UserID,
+		OldEmail: c.OldEmail,
+		NewEmail: c.NewEmail,
+	})
+	return nil
+}
+
+// RevertEmailChange cancels the change or, if it was confirmed already,
+// moves the account back to the old address. A confirmed change undone from
+// the old address suggests a takeover, so every session is closed.
+func (u *User) RevertEmailChange(c *EmailChange) error {
+	now := time.Now().UTC()
+	if c.UserID != u.UserID || c.RevertedAt != nil || now.After(c.UndoUntil) {
+		return ErrEmailChangeInvalid
+	}
+	if c.ConfirmedAt != nil && u.Email != c.NewEmail {
+		return ErrEmailChangeInvalid
+	}
+
+	c.RevertedAt = &now
+	if c.ConfirmedAt == nil {
+		return nil
+	}
+
+	u.Email = c.OldEmail
+	u.VerifiedAt = &now
+	u.UpdatedAt = now
+	u.revokeAll()
+
+	u.PushEvent(EmailChangeRevertedEvent{
+		At:       now,
+		UserID:   u.UserID,
+		OldEmail: c.OldEmail,
+		NewEmail: c.NewEmail,
+	})
+	return nil
+}
+
+type EmailChangeRequestedEvent struct {
+	At        time.Time
+	ChangeID  string
+	UserID    string
+	OldEmail  string
+	NewEmail  string
+	ExpiresAt time.Time
+	UndoUntil time.Time
+}
+
+func (e EmailChangeRequestedEvent) Type() string {
+	return EventEmailChangeRequested
+}
+
+func (e EmailChangeRequestedEvent) PublishedAt() time.Time {
+	return e.At
+}
+
+type EmailChangedEvent struct {
+	At       time.Time
+	UserID   string
+	OldEmail string
+	NewEmail string
+}
+
+func (e EmailChangedEvent) Type() string {
+	return EventEmailChanged
+}
+
+func (e EmailChangedEvent) PublishedAt() time.Time {
+	return e.At
+}
+
+type EmailChangeRevertedEvent struct {
+	At       time.Time
+	UserID   string
+	OldEmail string
+	NewEmail string
+}
+
+func (e EmailChangeRevertedEvent) Type() string {
+	return EventEmailChangeReverted
+}
+
+func (e EmailChangeRevertedEvent) PublishedAt() time.Time {
+	return e.At
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"time"
+)
+
+var (
+	ErrIdentityNotLinked        = errors.New("external identity is not linked")
+	ErrIdentityLinked           = errors.New("external identity is already linked")
+	ErrReauthenticationRequired = errors.New("recent authentication at a linked identity provider is required")
+)
+
+// ReauthenticationMaxAge is how long ago a login at an identity provider may
+// have happened to count as reauthentication.
+const ReauthenticationMaxAge = 5 * time.Minute
+
+const (
+	EventIdentityLinked = "user.identity_linked"
+)
+
+// ExternalIdentity is an account of the user at an OpenID Connect provider,
+// identified by the subject the provider issues ID tokens for.
+type ExternalIdentity struct {
+	Provider  string    `diff:"-"`
+	Subject   string    `diff:"-"`
+	Email     string    `diff:"email"`
+	CreatedAt time.Time `diff:"-"`
+}
+
+// NewExternalUser creates a user signed up through an identity provider.
+// The user has no password and the email is trusted as verified by the
+// provider.
+func NewExternalUser(userID, email, provider, subject string) *User {
+	now := time.Now().UTC()
+	u := &User{
+		Aggregate:  domain.Aggregate{},
+		UserID:     userID,
+		Email:      email,
+		VerifiedAt: &now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Role:       RoleUser,
+	}
+	u.PushEvent(&CreatedEvent{
+		At:     u.CreatedAt,
+		UserID: u.UserID,
+		Email:  u.Email,
+	})
+
+	_ = u.LinkIdentity(provider, subject, email)
+	return u
+}
+
+func (u *User) GetIdentity(provider, subject string) *ExternalIdentity {
+	for _, i := range u.Identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i
+		}
+	}
+	return nil
+}
+
+// LinkIdentity attaches an account at the provider to the user. A user can
+// have only one account per provider.
+func (u *User) LinkIdentity(provider, subject, email string) error {
+	for _, i := range u.Identities {
+		if i.Provider == provider {
+			return ErrIdentityLinked
+		}
+	}
+
+	now := time.Now().UTC()
+	u.Identities = append(u.Identities, &ExternalIdentity{
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: now,
+	})
+
+	u.PushEvent(IdentityLinkedEvent{
+		At:       now,
+		UserID:   u.UserID,
+		Provider: provider,
+	})
+	return nil
+}
+
+// AuthorizeExternal logs the user in with an identity the provider has
+// already authenticated. The second factor is still required if enabled.
+func (u *User) AuthorizeExternal(a Authorizer, provider, subject string, dev Device) (*Authorization, error) {
+	if u.GetIdentity(provider, subject) == nil {
+		return nil, ErrIdentityNotLinked
+	}
+
+	if u.IsLocked() {
+		return nil, ErrAccountLocked
+	}
+
+	if u.SecondFactorEnabled() {
+		return nil, ErrSecondFactorRequired
+	}
+
+	return u.addAuthorization(a.Issue(dev)), nil
+}
+
+// Reauthentication proves the user is present right before a sensitive
+// change of the account. Users with a password confirm it; users without one
+// log in again at a linked identity provider.
+type Reauthentication struct {
+	Password string
+	Provider string
+	Subject  string
+	AuthTime time.Time
+}
+
+func (u *User) Reauthenticate(a Authorizer, r Reauthentication) error {
+	if u.HasPassword() {
+		return a.VerifyPassword(u, r.Password)
+	}
+
+	if r.Provider == "" || u.GetIdentity(r.Provider, r.Subject) == nil {
+		return ErrReauthenticationRequired
+	}
+	if time.Since(r.AuthTime) > ReauthenticationMaxAge {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
+
+type IdentityLinkedEvent struct {
+	At       time.Time
+	UserID   string
+	Provider string
+}
+
+func (u IdentityLinkedEvent) Type() string {
+	return EventIdentityLinked
+}
+
+func (u IdentityLinkedEvent) PublishedAt() time.Time {
+	return u.At
+}
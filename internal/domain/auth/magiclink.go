@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"time"
+)
+
+var (
+	ErrMagicLinkInvalid     = errors.New("login link is invalid or expired")
+	ErrMagicLinkOtherDevice = fmt.Errorf("%w: link was requested from another browser", ErrMagicLinkInvalid)
+)
+
+const (
+	EventMagicLinkRequested = "user.magic_link_requested"
+)
+
+// MagicLink is a one-time passwordless login. It can only be used from the
+// browser it was requested on: the browser keeps a random nonce whose hash is
+// stored with the link.
+type MagicLink struct {
+	domain.Aggregate `diff:"-"`
+	LinkID           string     `diff:"-"`
+	UserID           string     `diff:"-"`
+	NonceHash        string     `diff:"-"`
+	Device           Device     `diff:"-"`
+	CreatedAt        time.Time  `diff:"-"`
+	ExpiresAt        time.Time  `diff:"-"`
+	UsedAt           *time.Time `diff:"used_at"`
+}
+
+// NewMagicLink creates a login link for the user. The signed token goes to
+// the user by email with the event and isn't stored.
+func NewMagicLink(linkID string, u *User, dev Device, nonceHash string, token string, ttl time.Duration) *MagicLink {
+	now := time.Now().UTC()
+	l := &MagicLink{
+		LinkID:    linkID,
+		UserID:    u.UserID,
+		NonceHash: nonceHash,
+		Device:    dev,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	l.PushEvent(MagicLinkRequestedEvent{
+		At:        now,
+		UserID:    u.UserID,
+		Email:     u.Email,
+		Token:     token,
+		ExpiresAt: l.ExpiresAt,
+		Device:    dev,
+	})
+	return l
+}
+
+// Use consumes the link. The device isn't compared: the user agent is
+// chosen by the client and the address changes easily on mobile networks.
+func (l *MagicLink) Use(nonceHash string) error {
+	now := time.Now().UTC()
+	if l.UsedAt != nil || now.After(l.ExpiresAt) {
+		return ErrMagicLinkInvalid
+	}
+
+	if l.NonceHash == "" || subtle.ConstantTimeCompare([]byte(l.NonceHash), []byte(nonceHash)) != 1 {
+		return ErrMagicLinkOtherDevice
+	}
+
+	l.UsedAt = &now
+	return nil
+}
+
+// AuthorizeMagicLink logs the user in with the link. Following the link
+// proves the ownership of the email, so it also verifies it.
+func (u *User) AuthorizeMagicLink(a Authorizer, l *MagicLink, nonceHash string, dev Device) (*Authorization, error) {
+	if l.UserID != u.UserID {
+		return nil, ErrMagicLinkInvalid
+	}
+
+	if err := l.Use(nonceHash); err != nil {
+		return nil, err
+	}
+
+	if u.IsLocked() {
+		return nil, ErrAccountLocked
+	}
+
+	if !u.IsVerified() {
+		if err := u.VerifyEmail(u.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	if u.SecondFactorEnabled() {
+		return nil, ErrSecondFactorRequired
+	}
+
+	return u.addAuthorization(a.Issue(dev)), nil
+}
+
+type MagicLinkRequestedEvent struct {
+	At        time.Time
+	UserID    string
+	Email     string
+	Token     string
+	ExpiresAt time.Time
+	Device    Device
+}
+
+func (e MagicLinkRequestedEvent) Type() string {
+	return EventMagicLinkRequested
+}
+
+func (e MagicLinkRequestedEvent) PublishedAt() time.Time {
+	return e.At
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"time"
+)
+
+var (
+	ErrSecondFactorRequired = errors.New("second factor required")
+	ErrInvalidSecondFactor  = errors.New("invalid second factor code")
+	ErrSecondFactorEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrSecondFactorDisabled = errors.New("two-factor authentication is not enabled")
+	ErrChallengeInvalid     = errors.New("second factor challenge is invalid or expired")
+)
+
+// MaxChallengeFailures is the number of wrong codes after which a second
+// factor challenge can't be used anymore and the login has to start over.
+const MaxChallengeFailures = 5
+
+const (
+	EventSecondFactorEnabled  = "user.second_factor_enabled"
+	EventSecondFactorDisabled = "user.second_factor_disabled"
+)
+
+type RecoveryCode struct {
+	Hash   string     `diff:"-"`
+	UsedAt *time.Time `diff:"used_at"`
+}
+
+type TOTP struct {
+	Secret        string          `diff:"secret"`
+	CreatedAt     time.Time       `diff:"-"`
+	ConfirmedAt   *time.Time      `diff:"confirmed_at"`
+	LastUsedStep  int64           `diff:"last_used_step"`
+	RecoveryCodes []*RecoveryCode `diff:"-"`
+}
+
+// AcceptStep records the time step of a used code. A code can only be used
+// once, so steps that are not newer than the last accepted one are rejected.
+func (t *TOTP) AcceptStep(step int64) bool {
+	if step <= t.LastUsedStep {
+		return false
+	}
+	t.LastUsedStep = step
+	return true
+}
+
+func (t *TOTP) UseRecoveryCode(hash string) bool {
+	for _, code := range t.RecoveryCodes {
+		if code.UsedAt == nil && code.Hash == hash {
+			now := time.Now().UTC()
+			code.UsedAt = &now
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) SecondFactorEnabled() bool {
+	return u.TOTP != nil && u.TOTP.ConfirmedAt != nil
+}
+
+// EnrollTOTP stores a new secret that has to be confirmed with a code
+// before it is required on login.
+func (u *User) EnrollTOTP(secret string) error {
+	if u.SecondFactorEnabled() {
+		return ErrSecondFactorEnabled
+	}
+
+	u.TOTP = &TOTP{
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	return nil
+}
+
+func (u *User) ConfirmTOTP(a Authorizer, code string, recoveryCodeHashes []string) error {
+	if u.TOTP == nil {
+		return ErrSecondFactorDisabled
+	}
+
+	if u.SecondFactorEnabled() {
+		return ErrSecondFactorEnabled
+	}
+
+	if err := a.VerifySecondFactor(u, code); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	u.TOTP.ConfirmedAt = &now
+	u.TOTP.RecoveryCodes = make([]*RecoveryCode, 0, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		u.TOTP.RecoveryCodes = append(u.TOTP.RecoveryCodes, &RecoveryCode{Hash: hash})
+	}
+
+	u.PushEvent(SecondFactorEnabledEvent{
+		At:     now,
+		UserID: u.UserID,
+	})
+	return nil
+}
+
+func (u *User) DisableTOTP(a Authorizer, r Reauthentication, code string) error {
+	if !u.SecondFactorEnabled() {
+		return ErrSecondFactorDisabled
+	}
+
+	if err := u.Reauthenticate(a, r); err != nil {
+		return err
+	}
+
+	if err := a.VerifySecondFactor(u, code); err != nil {
+		return err
+	}
+
+	u.TOTP = nil
+	u.PushEvent(SecondFactorDisabledEvent{
+		At:     time.Now().UTC(),
+		UserID: u.UserID,
+	})
+	return nil
+}
+
+// AuthorizeSecondFactor finishes a login that was interrupted with
+// ErrSecondFactorRequired.
+func (u *User) AuthorizeSecondFactor(a Authorizer, code string, dev Device) (*Authorization, error) {
+	if !u.SecondFactorEnabled() {
+		return nil, ErrSecondFactorDisabled
+	}
+
+	if err := a.VerifySecondFactor(u, code); err != nil {
+		return nil, err
+	}
+
+	if u.IsLocked() {
+		return nil, ErrAccountLocked
+	}
+
+	return u.addAuthorization(a.Issue(dev)), nil
+}
+
+// SecondFactorChallenge is a login waiting for the second factor. It can be
+// completed only once and is discarded after MaxChallengeFailures wrong
+// codes.
+type SecondFactorChallenge struct {
+	domain.Aggregate `diff:"-"`
+	ChallengeID      string     `diff:"-"`
+	UserID           string     `diff:"-"`
+	CreatedAt        time.Time  `diff:"-"`
+	ExpiresAt        time.Time  `diff:"-"`
+	Failures         int        `diff:"failures"`
+	UsedAt           *time.Time `diff:"used_at"`
+}
+
+func NewSecondFactorChallenge(challengeID, userID string, ttl time.Duration) *SecondFactorChallenge {
+	now := time.Now().UTC()
+	return &SecondFactorChallenge{
+		ChallengeID: challengeID,
+		UserID:      userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+}
+
+func (c *SecondFactorChallenge) Check(now time.Time) error {
+	if c.UsedAt != nil || now.After(c.ExpiresAt) || c.Failures >= MaxChallengeFailures {
+		return ErrChallengeInvalid
+	}
+	return nil
+}
+
+func (c *SecondFactorChallenge) Fail() {
+	c.Failures++
+}
+
+func (c *SecondFactorChallenge) Use(now time.Time) {
+	c.UsedAt = &now
+}
+
+type SecondFactorEnabledEvent struct {
+	At     time.Time
+	UserID string
+}
+
+func (e SecondFactorEnabledEvent) Type() string {
+	return EventSecondFactorEnabled
+}
+
+func (e SecondFactorEnabledEvent) PublishedAt() time.Time {
+	return e.At
+}
+
+type SecondFactorDisabledEvent struct {
+	At     time.Time
+	UserID string
+}
+
+func (e SecondFactorDisabledEvent) Type() string {
+	return EventSecondFactorDisabled
+}
+
+func (e SecondFactorDisabledEvent) PublishedAt() time.Time {
+	return e.At
+}
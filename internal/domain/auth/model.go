@@ -17,47 +17,82 @@ var (
 	ErrUserEmailDuplicate  = fmt.Errorf("%w: email is not unique", ErrUserExists)
 	ErrInvalidCredentials  = errors.New("email or password is invalid")
 	ErrUnauthorized        = errors.New("unauthorized")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrEmailNotVerified    = errors.New("email is not verified")
+	ErrEmailVerified       = errors.New("email is already verified")
+	ErrVerificationInvalid = errors.New("verification link is invalid")
+	ErrRefreshTokenReused  = fmt.Errorf("%w: refresh token reuse detected", ErrUnauthorized)
 )
 
 const (
 	EventCreated  = "user.created"
 	EventNewLogin = "user.login"
 	EventLogout   = "user.logout"
+
+	EventLoginFailed    = "user.login_failed"
+	EventNewDeviceLogin = "user.new_device_login"
+	EventRefreshed      = "user.refresh"
+
+	EventRefreshReuseDetected = "user.refresh_reuse_detected"
+	EventPasswordChanged      = "user.password_changed"
+
+	EventEmailVerificationRequested = "user.email_verification_requested"
+	EventEmailVerified              = "user.email_verified"
+
+	EventDeleted = "user.deleted"
 )
 
 type Authorizer interface {
 	Hash(password string) string
-	Authorize(u *User, password string, dev Device) (*Authorization, error)
+	VerifyPassword(u *User, password string) error
+	NeedsRehash(u *User) bool
+	VerifySecondFactor(u *User, code string) error
+	Issue(dev Device) *Authorization
+	Renew(a *Authorization) *Authorization
 }
 
 type Device struct {
 	Browser   string `diff:"browser"`
 	OS        string `diff:"os"`
 	IPAddress string `diff:"ip_address"`
-	Model     string `diff:"model"`
+	Model     string `diff:"device_model"`
+	Country   string `diff:"country"`
+	ASN       uint32 `diff:"asn"`
+	ASOrg     string `diff:"as_org"`
 }
 
+// Authorization is a single refresh token issued to a device. Every refresh
+// replaces the authorization with a new one from the same family, so the
+// family identifies the login session as a whole.
 type Authorization struct {
 	ID         string     `diff:"-"`
+	FamilyID   string     `diff:"-"`
 	Secret     string     `diff:"-"`
 	CreatedAt  time.Time  `diff:"-"`
 	ValidUntil time.Time  `diff:"valid_until"`
 	LogoutAt   *time.Time `diff:"logout_at"`
+	RotatedAt  *time.Time `diff:"rotated_at"`
 	Device     Device     `diff:"-"`
 }
 
 func (a *Authorization) IsActive() bool {
-	return time.Now().Before(a.ValidUntil) && a.LogoutAt == nil
+	return time.Now().Before(a.ValidUntil) && a.LogoutAt == nil && a.RotatedAt == nil
 }
 
 type User struct {
 	domain.Aggregate `diff:"-"`
-	UserID           string           `diff:"-"`
-	Email            string           `diff:"email"`
-	PasswordHash     string           `diff:"password_hash"`
-	CreatedAt        time.Time        `diff:"-"`
-	UpdatedAt        time.Time        `diff:"updated_at"`
-	Authorizations   []*Authorization `diff:"-"`
+	UserID           string              `diff:"-"`
+	Email            string              `diff:"email"`
+	PasswordHash     string              `diff:"password_hash"`
+	VerifiedAt       *time.Time          `diff:"verified_at"`
+	CreatedAt        time.Time           `diff:"-"`
+	UpdatedAt        time.Time           `diff:"updated_at"`
+	DeletedAt        *time.Time          `diff:"deleted_at"`
+	Role             string              `diff:"role"`
+	LockedAt         *time.Time          `diff:"locked_at"`
+	Authorizations   []*Authorization    `diff:"-"`
+	TOTP             *TOTP               `diff:"-"`
+	Identities       []*ExternalIdentity `diff:"-"`
 }
 
 func (u *User) GetAuthByID(authId string) *Authorization {
@@ -89,6 +124,7 @@ func NewUser(
 		UserID:       userID,
 		Email:        email,
 		PasswordHash: hasher.Hash(password),
+		Role:         RoleUser,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
@@ -101,22 +137,78 @@ func NewUser(
 }
 
 func (u *User) Authorize(a Authorizer, password string, dev Device) (*Authorization, error) {
-
-	auth, err := a.Authorize(u, password, dev)
-	if err != nil {
+	if err := a.VerifyPassword(u, password); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			u.PushEvent(LoginFailedEvent{
+				At:     time.Now().UTC(),
+				UserID: u.UserID,
+				Device: dev,
+			})
+		}
 		return nil, err
 	}
 
+	// The password is only known here, so outdated hashes are upgraded on
+	// login.
+	if a.NeedsRehash(u) {
+		u.PasswordHash = a.Hash(password)
+		u.UpdatedAt = time.Now().UTC()
+	}
+
+	if u.IsLocked() {
+		return nil, ErrAccountLocked
+	}
+
+	if u.SecondFactorEnabled() {
+		return nil, ErrSecondFactorRequired
+	}
+
+	return u.addAuthorization(a.Issue(dev)), nil
+}
+
+// AuthorizeNewUser starts the first session of a user that has just signed
+// up with the password, so it isn't verified again.
+func (u *User) AuthorizeNewUser(a Authorizer, dev Device) (*Authorization, error) {
+	if len(u.Authorizations) != 0 || !u.HasPassword() {
+		return nil, ErrUnauthorized
+	}
+	return u.addAuthorization(a.Issue(dev)), nil
+}
+
+func (u *User) addAuthorization(auth *Authorization) *Authorization {
+	now := time.Now().UTC()
+	if len(u.Authorizations) != 0 && !u.knownDevice(auth.Device) {
+		u.PushEvent(NewDeviceLoginEvent{
+			At:     now,
+			UserID: u.UserID,
+			Email:  u.Email,
+			ID:     auth.ID,
+			Device: auth.Device,
+		})
+	}
+
 	u.Authorizations = append(u.Authorizations, auth)
 
 	u.PushEvent(LoginEvent{
-		At:     time.Now().UTC(),
+		At:     now,
 		UserID: u.UserID,
-		ID:     auth.Secret,
+		ID:     auth.ID,
 		Device: auth.Device,
 	})
 
-	return auth, nil
+	return auth
+}
+
+// knownDevice reports whether the user has logged in from the same browser,
+// OS and address before.
+func (u *User) knownDevice(dev Device) bool {
+	for _, a := range u.Authorizations {
+		d := a.Device
+		if d.Browser == dev.Browser && d.OS == dev.OS && d.IPAddress == dev.IPAddress {
+			return true
+		}
+	}
+	return false
 }
 
 func (u *User) Logout(authId string) error {
@@ -130,18 +222,223 @@ func (u *User) Logout(authId string) error {
 		return fmt.Errorf("%w: authorization already closed", ErrUnauthorized)
 	}
 
+	u.revokeFamily(auth.FamilyID)
+	return nil
+}
+
+// Refresh exchanges the refresh token secret for a new authorization of the
+// same family. Presenting a secret that was already rotated means the token
+// leaked, so the whole family is revoked.
+func (u *User) Refresh(a Authorizer, secret string) (*Authorization, error) {
+	prev := u.GetAuthBySecret(secret)
+	if prev == nil {
+		return nil, fmt.Errorf("%w: refresh token not found", ErrUnauthorized)
+	}
+
+	if prev.RotatedAt != nil {
+		u.revokeFamily(prev.FamilyID)
+		u.PushEvent(RefreshReuseDetectedEvent{
+			At:       time.Now().UTC(),
+			UserID:   u.UserID,
+			ID:       prev.ID,
+			FamilyID: prev.FamilyID,
+			Device:   prev.Device,
+		})
+		return nil, ErrRefreshTokenReused
+	}
+
+	if !prev.IsActive() {
+		return nil, fmt.Errorf("%w: authorization is not active", ErrUnauthorized)
+	}
+
+	if u.IsLocked() {
+		return nil, ErrAccountLocked
+	}
+
+	next := a.Renew(prev)
 	now := time.Now().UTC()
-	auth.LogoutAt = &now
+	prev.RotatedAt = &now
+	u.Authorizations = append(u.Authorizations, next)
+
+	u.PushEvent(RefreshedEvent{
+		At:       now,
+		UserID:   u.UserID,
+		ID:       next.ID,
+		FamilyID: next.FamilyID,
+		Device:   next.Device,
+	})
+
+	return next, nil
+}
+
+func (u *User) Sessions() []*Authorization {
+	sessions := make([]*Authorization, 0)
+	for _, auth := range u.Authorizations {
+		if auth.IsActive() {
+			sessions = append(sessions, auth)
+		}
+	}
+	return sessions
+}
+
+// SessionStartedAt returns when the first authorization of the session was
+// issued.
+func (u *User) SessionStartedAt(sessionID string) (startedAt time.Time) {
+	for _, a := range u.Authorizations {
+		if a.FamilyID == sessionID && (startedAt.IsZero() || a.CreatedAt.Before(startedAt)) {
+			startedAt = a.CreatedAt
+		}
+	}
+	return startedAt
+}
+
+func (u *User) RevokeSession(sessionID string) error {
+	for _, auth := range u.Sessions() {
+		if auth.FamilyID == sessionID {
+			u.revokeFamily(sessionID)
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (u *User) RevokeOtherSessions(currentAuthID string) error {
+	current := u.GetAuthByID(currentAuthID)
+	if current == nil {
+		return fmt.Errorf("%w: provided identifier not found", ErrUnauthorized)
+	}
+
+	for _, auth := range u.Sessions() {
+		if auth.FamilyID != current.FamilyID {
+			u.revokeFamily(auth.FamilyID)
+		}
+	}
+	return nil
+}
+
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+func (u *User) IsVerified() bool {
+	return u.VerifiedAt != nil
+}
 
-	u.PushEvent(LogoutEvent{
+func (u *User) RequestEmailVerification() error {
+	if u.IsVerified() {
+		return ErrEmailVerified
+	}
+
+	u.PushEvent(EmailVerificationRequestedEvent{
 		At:     time.Now().UTC(),
 		UserID: u.UserID,
-		ID:     auth.ID,
+		Email:  u.Email,
 	})
+	return nil
+}
+
+// VerifyEmail confirms the address the verification link was sent to.
+// A link sent before the email was changed no longer matches.
+func (u *User) VerifyEmail(email string) error {
+	if u.Email != email {
+		return ErrVerificationInvalid
+	}
+
+	if u.IsVerified() {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	u.VerifiedAt = &now
+	u.UpdatedAt = now
+
+	u.PushEvent(EmailVerifiedEvent{
+		At:     now,
+		UserID: u.UserID,
+		Email:  u.Email,
+	})
+	return nil
+}
+
+// ResetPassword replaces the password and closes every session of the user.
+func (u *User) ResetPassword(a Authorizer, password string) {
+	u.setPassword(a, password)
+	u.revokeAll()
+}
+
+// ChangePassword replaces the password after checking the current one.
+// Sessions are kept; the caller decides whether to revoke the others.
+func (u *User) ChangePassword(oldPassword, newPassword string, a Authorizer) error {
+	if err := a.VerifyPassword(u, oldPassword); err != nil {
+		return err
+	}
+
+	u.setPassword(a, newPassword)
+	return nil
+}
+
+// Delete closes every session and strips the personal data from the account.
+// The row itself is kept until the grace period ends and it is purged.
+func (u *User) Delete(a Authorizer, r Reauthentication) error {
+	if err := u.Reauthenticate(a, r); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	u.revokeAll()
+	for _, auth := range u.Authorizations {
+		auth.Device = Device{}
+	}
+
+	u.Email = "deleted+" + u.UserID + "@invalid"
+	u.PasswordHash = ""
+	u.VerifiedAt = nil
+	u.TOTP = nil
+	u.Identities = nil
+	u.UpdatedAt = now
+	u.DeletedAt = &now
 
+	u.PushEvent(DeletedEvent{
+		At:     now,
+		UserID: u.UserID,
+	})
 	return nil
 }
 
+func (u *User) setPassword(a Authorizer, password string) {
+	u.PasswordHash = a.Hash(password)
+	u.UpdatedAt = time.Now().UTC()
+
+	u.PushEvent(PasswordChangedEvent{
+		At:     u.UpdatedAt,
+		UserID: u.UserID,
+	})
+}
+
+func (u *User) revokeAll() {
+	for _, auth := range u.Authorizations {
+		if auth.LogoutAt == nil {
+			u.revokeFamily(auth.FamilyID)
+		}
+	}
+}
+
+func (u *User) revokeFamily(familyID string) {
+	now := time.Now().UTC()
+	for _, auth := range u.Authorizations {
+		if auth.FamilyID != familyID || auth.LogoutAt != nil {
+			continue
+		}
+
+		auth.LogoutAt = &now
+		u.PushEvent(LogoutEvent{
+			At:     now,
+			UserID: u.UserID,
+			ID:     auth.ID,
+		})
+	}
+}
+
 type CreatedEvent struct {
 	At        time.Time
 	UserID    string
@@ -173,6 +470,52 @@ func (u LoginEvent) PublishedAt() time.Time {
 	return u.At
 }
 
+type LoginFailedEvent struct {
+	At     time.Time
+	UserID string
+	Device Device
+}
+
+func (u LoginFailedEvent) Type() string {
+	return EventLoginFailed
+}
+
+func (u LoginFailedEvent) PublishedAt() time.Time {
+	return u.At
+}
+
+type NewDeviceLoginEvent struct {
+	At     time.Time
+	UserID string
+	Email  string
+	ID     string
+	Device Device
+}
+
+func (u NewDeviceLoginEvent) Type() string {
+	return EventNewDeviceLogin
+}
+
+func (u NewDeviceLoginEvent) PublishedAt() time.Time {
+	return u.At
+}
+
+type RefreshedEvent struct {
+	At       time.Time
+	UserID   string
+	ID       string
+	FamilyID string
+	Device   Device
+}
+
+func (u RefreshedEvent) Type() string {
+	return EventRefreshed
+}
+
+func (u RefreshedEvent) PublishedAt() time.Time {
+	return u.At
+}
+
 type LogoutEvent struct {
 	At     time.Time
 	UserID string
@@ -180,9 +523,79 @@ type LogoutEvent struct {
 }
 
 func (u LogoutEvent) Type() string {
-	return EventNewLogin
+	return EventLogout
 }
 
 func (u LogoutEvent) PublishedAt() time.Time {
 	return u.At
 }
+
+type RefreshReuseDetectedEvent struct {
+	At       time.Time
+	UserID   string
+	ID       string
+	FamilyID string
+	Device   Device
+}
+
+func (u RefreshReuseDetectedEvent) Type() string {
+	return EventRefreshReuseDetected
+}
+
+func (u RefreshReuseDetectedEvent) PublishedAt() time.Time {
+	return u.At
+}
+
+type PasswordChangedEvent struct {
+	At     time.Time
+	UserID string
+}
+
+func (u PasswordChangedEvent) Type() string {
+	return EventPasswordChanged
+}
+
+func (u PasswordChangedEvent) PublishedAt() time.Time {
+	return u.At
+}
+
+type EmailVerificationRequestedEvent struct {
+	At     time.Time
+	UserID string
+	Email  string
+}
+
+func (u EmailVerificationRequestedEvent) Type() string {
+	return EventEmailVerificationRequested
+}
+
+func (u EmailVerificationRequestedEvent) PublishedAt() time.Time {
+	return u.At
+}
+
+type EmailVerifiedEvent struct {
+	At     time.Time
+	UserID string
+	Email  string
+}
+
+func (u EmailVerifiedEvent) Type() string {
+	return EventEmailVerified
+}
+
+func (u EmailVerifiedEvent) PublishedAt() time.Time {
+	return u.At
+}
+
+type DeletedEvent struct {
+	At     time.Time
+	UserID string
+}
+
+func (u DeletedEvent) Type() string {
+	return EventDeleted
+}
+
+func (u DeletedEvent) PublishedAt() time.Time {
+	return u.At
+}
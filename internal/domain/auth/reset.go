@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"time"
+)
+
+var (
+	ErrPasswordResetInvalid = errors.New("password reset token is invalid or expired")
+)
+
+const (
+	EventPasswordResetRequested = "user.password_reset_requested"
+)
+
+type PasswordReset struct {
+	domain.Aggregate `diff:"-"`
+	ResetID          string     `diff:"-"`
+	UserID           string     `diff:"-"`
+	TokenHash        string     `diff:"token_hash"`
+	CreatedAt        time.Time  `diff:"-"`
+	ExpiresAt        time.Time  `diff:"-"`
+	UsedAt           *time.Time `diff:"used_at"`
+}
+
+// NewPasswordReset creates a reset request for the user. The token is
+// issued when the reset is mailed, so it never travels with the event.
+func NewPasswordReset(resetID string, u *User, ttl time.Duration) *PasswordReset {
+	now := time.Now().UTC()
+	r := &PasswordReset{
+		ResetID:   resetID,
+		UserID:    u.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	r.PushEvent(PasswordResetRequestedEvent{
+		At:        now,
+		ResetID:   resetID,
+		UserID:    u.UserID,
+		Email:     u.Email,
+		ExpiresAt: r.ExpiresAt,
+	})
+	return r
+}
+
+// IssueToken stores the hash of the token mailed to the user. A reset is
+// issued a token only once.
+func (r *PasswordReset) IssueToken(tokenHash string) error {
+	if r.TokenHash != "" || r.UsedAt != nil || time.Now().After(r.ExpiresAt) {
+		return ErrPasswordResetInvalid
+	}
+	r.TokenHash = tokenHash
+	return nil
+}
+
+func (r *PasswordReset) Use() error {
+	now := time.Now().UTC()
+	if r.UsedAt != nil || now.After(r.ExpiresAt) {
+		return ErrPasswordResetInvalid
+	}
+	r.UsedAt = &now
+	return nil
+}
+
+type PasswordResetRequestedEvent struct {
+	At        time.Time
+	ResetID   string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+}
+
+func (e PasswordResetRequestedEvent) Type() string {
+	return EventPasswordResetRequested
+}
+
+func (e PasswordResetRequestedEvent) PublishedAt() time.Time {
+	return e.At
+}
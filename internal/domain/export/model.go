@@ -0,0 +1,113 @@
+package export
+
+import (
+	"errors"
+	"github.com/burenotti/go_health_backend/internal/domain"
+	"time"
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready")
+	ErrExportExpired  = errors.New("export expired")
+)
+
+const (
+	EventRequested = "export.requested"
+	EventReady     = "export.ready"
+)
+
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+type Export struct {
+	domain.Aggregate `diff:"-"`
+	ExportID         string     `diff:"-"`
+	UserID           string     `diff:"-"`
+	Status           string     `diff:"status"`
+	CreatedAt        time.Time  `diff:"-"`
+	CompletedAt      *time.Time `diff:"completed_at"`
+	ExpiresAt        *time.Time `diff:"expires_at"`
+	Archive          []byte     `diff:"-"`
+}
+
+func New(exportID, userID string) *Export {
+	e := &Export{
+		ExportID:  exportID,
+		UserID:    userID,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	e.PushEvent(RequestedEvent{
+		At:       e.CreatedAt,
+		ExportID: e.ExportID,
+		UserID:   e.UserID,
+	})
+	return e
+}
+
+// Complete stores the archive, which can be downloaded until ttl passes.
+func (e *Export) Complete(archive []byte, ttl time.Duration) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+
+	e.Status = StatusReady
+	e.Archive = archive
+	e.CompletedAt = &now
+	e.ExpiresAt = &expiresAt
+
+	e.PushEvent(ReadyEvent{
+		At:        now,
+		ExportID:  e.ExportID,
+		UserID:    e.UserID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (e *Export) Fail() {
+	now := time.Now().UTC()
+	e.Status = StatusFailed
+	e.CompletedAt = &now
+}
+
+func (e *Export) Download() ([]byte, error) {
+	if e.Status != StatusReady {
+		return nil, ErrExportNotReady
+	}
+	if e.ExpiresAt != nil && time.Now().After(*e.ExpiresAt) {
+		return nil, ErrExportExpired
+	}
+	return e.Archive, nil
+}
+
+type RequestedEvent struct {
+	At       time.Time
+	ExportID string
+	UserID   string
+}
+
+func (e RequestedEvent) Type() string {
+	return EventRequested
+}
+
+func (e RequestedEvent) PublishedAt() time.Time {
+	return e.At
+}
+
+type ReadyEvent struct {
+	At        time.Time
+	ExportID  string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+func (e ReadyEvent) Type() string {
+	return EventReady
+}
+
+func (e ReadyEvent) PublishedAt() time.Time {
+	return e.At
+}
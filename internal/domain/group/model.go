@@ -9,6 +9,7 @@ import (
 var (
 	ErrGroupNotFound = errors.New("group not found")
 	ErrGroupExists   = errors.New("group already exists")
+	ErrGroupArchived = errors.New("group is archived")
 )
 
 type TraineeID string
@@ -17,13 +18,14 @@ type InviteID string
 type GroupID string
 
 type Group struct {
-	domain.Aggregate
-	GroupID     GroupID   `diff:"group_id"`
-	Name        string    `diff:"name"`
-	Description string    `diff:"description"`
-	CoachID     CoachID   `diff:"coach_id"`
-	CreatedAt   time.Time `diff:"created_at"`
-	UpdatedAt   time.Time `diff:"updated_at"`
+	domain.Aggregate `diff:"-"`
+	GroupID          GroupID    `diff:"group_id"`
+	Name             string     `diff:"name"`
+	Description      string     `diff:"description"`
+	CoachID          CoachID    `diff:"coach_id"`
+	CreatedAt        time.Time  `diff:"created_at"`
+	UpdatedAt        time.Time  `diff:"updated_at"`
+	ArchivedAt       *time.Time `diff:"archived_at"`
 }
 
 func New(
@@ -42,6 +44,29 @@ func New(
 	}
 }
 
+func (g *Group) IsArchived() bool {
+	return g.ArchivedAt != nil
+}
+
+// Archive makes the group read-only. Archived groups outlive their coach.
+func (g *Group) Archive() {
+	if g.ArchivedAt != nil {
+		return
+	}
+	now := time.Now().UTC()
+	g.ArchivedAt = &now
+	g.UpdatedAt = now
+}
+
+func (g *Group) TransferTo(coachID CoachID) error {
+	if g.IsArchived() {
+		return ErrGroupArchived
+	}
+	g.CoachID = coachID
+	g.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
 type Member struct {
 	TraineeID TraineeID
 	Email     string
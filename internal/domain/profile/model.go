@@ -19,14 +19,16 @@ const (
 type Profile interface {
 	Type() string
 	ID() string
+	Anonymize()
+	Update(p Patch, now time.Time) error
 }
 
 type Trainee struct {
-	domain.Aggregate
-	UserID    string
-	FirstName string
-	LastName  string
-	BirthDate *time.Time
+	domain.Aggregate `diff:"-"`
+	UserID           string     `diff:"-"`
+	FirstName        string     `diff:"first_name"`
+	LastName         string     `diff:"last_name"`
+	BirthDate        *time.Time `diff:"birth_date"`
 }
 
 func NewTrainee(
@@ -51,14 +53,20 @@ func (*Trainee) Type() string {
 	return TypeTrainee
 }
 
+func (t *Trainee) Anonymize() {
+	t.FirstName = ""
+	t.LastName = ""
+	t.BirthDate = nil
+}
+
 type Coach struct {
-	domain.Aggregate
-	UserID          string
-	FirstName       string
-	LastName        string
-	BirthDate       *time.Time
-	YearsExperience int
-	Bio             string
+	domain.Aggregate `diff:"-"`
+	UserID           string     `diff:"-"`
+	FirstName        string     `diff:"first_name"`
+	LastName         string     `diff:"last_name"`
+	BirthDate        *time.Time `diff:"birth_date"`
+	YearsExperience  int        `diff:"years_experience"`
+	Bio              string     `diff:"bio"`
 }
 
 func NewCoach(
@@ -86,3 +94,11 @@ func (c *Coach) ID() string {
 func (*Coach) Type() string {
 	return TypeCoach
 }
+
+func (c *Coach) Anonymize() {
+	c.FirstName = ""
+	c.LastName = ""
+	c.BirthDate = nil
+	c.YearsExperience = 0
+	c.Bio = ""
+}
@@ -0,0 +1,172 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid profile update")
+)
+
+const (
+	EventUpdated = "profile.updated"
+)
+
+const (
+	maxNameLength      = 20
+	maxBioLength       = 2000
+	maxYearsExperience = 80
+)
+
+// Field is a value of a partial update. Fields that aren't set are left as
+// they are.
+type Field[T any] struct {
+	Value T
+	Set   bool
+}
+
+func Set[T any](v T) Field[T] {
+	return Field[T]{Value: v, Set: true}
+}
+
+// Patch is a partial profile update. Setting a field to its zero value
+// clears it.
+type Patch struct {
+	FirstName       Field[string]
+	LastName        Field[string]
+	BirthDate       Field[*time.Time]
+	YearsExperience Field[int]
+	Bio             Field[string]
+}
+
+func (p Patch) validate(now time.Time) error {
+	if p.FirstName.Set && utf8.RuneCountInString(p.FirstName.Value) > maxNameLength {
+		return fmt.Errorf("%w: first name is longer than %d characters", ErrInvalidPatch, maxNameLength)
+	}
+	if p.LastName.Set && utf8.RuneCountInString(p.LastName.Value) > maxNameLength {
+		return fmt.Errorf("%w: last name is longer than %d characters", ErrInvalidPatch, maxNameLength)
+	}
+	if p.BirthDate.Set && p.BirthDate.Value != nil && p.BirthDate.Value.After(now) {
+		return fmt.Errorf("%w: birth date is in the future", ErrInvalidPatch)
+	}
+	if p.YearsExperience.Set && (p.YearsExperience.Value < 0 || p.YearsExperience.Value > maxYearsExperience) {
+		return fmt.Errorf("%w: years of experience must be between 0 and %d", ErrInvalidPatch, maxYearsExperience)
+	}
+	if p.Bio.Set && utf8.RuneCountInString(p.Bio.Value) > maxBioLength {
+		return fmt.Errorf("%w: bio is longer than %d characters", ErrInvalidPatch, maxBioLength)
+	}
+	return nil
+}
+
+// New creates a profile of the given type filled with the fields.
+func New(userID, profileType string, fields Patch, now time.Time) (Profile, error) {
+	switch profileType {
+	case TypeTrainee:
+		t := &Trainee{UserID: userID}
+		_, err := t.apply(fields, now)
+		return t, err
+	case TypeCoach:
+		c := &Coach{UserID: userID}
+		_, err := c.apply(fields, now)
+		return c, err
+	default:
+		return nil, fmt.Errorf("%w: unknown profile type %q", ErrInvalidPatch, profileType)
+	}
+}
+
+func (t *Trainee) Update(p Patch, now time.Time) error {
+	changed, err := t.apply(p, now)
+	if err != nil {
+		return err
+	}
+	t.pushUpdated(now, changed)
+	return nil
+}
+
+func (t *Trainee) apply(p Patch, now time.Time) ([]string, error) {
+	if p.YearsExperience.Set || p.Bio.Set {
+		return nil, fmt.Errorf("%w: trainee profiles have no experience or bio", ErrInvalidPatch)
+	}
+	if err := p.validate(now); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	changed = apply(&t.FirstName, p.FirstName, "first_name", changed)
+	changed = apply(&t.LastName, p.LastName, "last_name", changed)
+	changed = applyDate(&t.BirthDate, p.BirthDate, "birth_date", changed)
+	return changed, nil
+}
+
+func (c *Coach) Update(p Patch, now time.Time) error {
+	changed, err := c.apply(p, now)
+	if err != nil {
+		return err
+	}
+	c.pushUpdated(now, changed)
+	return nil
+}
+
+func (c *Coach) apply(p Patch, now time.Time) ([]string, error) {
+	if err := p.validate(now); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	changed = apply(&c.FirstName, p.FirstName, "first_name", changed)
+	changed = apply(&c.LastName, p.LastName, "last_name", changed)
+	changed = applyDate(&c.BirthDate, p.BirthDate, "birth_date", changed)
+	changed = apply(&c.YearsExperience, p.YearsExperience, "years_experience", changed)
+	changed = apply(&c.Bio, p.Bio, "bio", changed)
+	return changed, nil
+}
+
+func (t *Trainee) pushUpdated(now time.Time, changed []string) {
+	if len(changed) != 0 {
+		t.PushEvent(UpdatedEvent{At: now, UserID: t.UserID, ProfileType: TypeTrainee, Fields: changed})
+	}
+}
+
+func (c *Coach) pushUpdated(now time.Time, changed []string) {
+	if len(changed) != 0 {
+		c.PushEvent(UpdatedEvent{At: now, UserID: c.UserID, ProfileType: TypeCoach, Fields: changed})
+	}
+}
+
+func apply[T comparable](dst *T, f Field[T], name string, changed []string) []string {
+	if !f.Set || *dst == f.Value {
+		return changed
+	}
+	*dst = f.Value
+	return append(changed, name)
+}
+
+func applyDate(dst **time.Time, f Field[*time.Time], name string, changed []string) []string {
+	if !f.Set {
+		return changed
+	}
+	if *dst == nil && f.Value == nil || *dst != nil && f.Value != nil && (*dst).Equal(*f.Value) {
+		return changed
+	}
+	*dst = f.Value
+	return append(changed, name)
+}
+
+// UpdatedEvent lists the names of the fields an update changed.
+type UpdatedEvent struct {
+	At          time.Time
+	UserID      string
+	ProfileType string
+	Fields      []string
+}
+
+func (e UpdatedEvent) Type() string {
+	return EventUpdated
+}
+
+func (e UpdatedEvent) PublishedAt() time.Time {
+	return e.At
+}
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE authorizations
+    ADD COLUMN family_id uuid NULL DEFAULT NULL;
+
+UPDATE authorizations
+SET family_id = authorization_id
+WHERE TRUE;
+
+ALTER TABLE authorizations
+    ALTER COLUMN family_id SET NOT NULL;
+
+ALTER TABLE authorizations
+    ADD COLUMN rotated_at timestamptz NULL DEFAULT NULL;
+
+CREATE UNIQUE INDEX authorizations_secret_idx ON authorizations (secret);
+CREATE INDEX authorizations_family_id_idx ON authorizations (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX authorizations_family_id_idx;
+DROP INDEX authorizations_secret_idx;
+
+ALTER TABLE authorizations
+    DROP COLUMN rotated_at;
+
+ALTER TABLE authorizations
+    DROP COLUMN family_id;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE password_resets
+(
+    reset_id   uuid        NOT NULL PRIMARY KEY,
+    user_id    uuid        NOT NULL REFERENCES users ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz NULL     DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE password_resets;
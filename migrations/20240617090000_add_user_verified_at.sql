@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN verified_at timestamptz NULL DEFAULT NULL;
+
+-- Accounts created before verification existed are trusted as they are.
+UPDATE users
+SET verified_at = created_at;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN verified_at;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE totp_secrets
+(
+    user_id        uuid        NOT NULL PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret         VARCHAR(64) NOT NULL,
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    confirmed_at   timestamptz NULL     DEFAULT NULL,
+    last_used_step BIGINT      NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes
+(
+    user_id   uuid        NOT NULL REFERENCES totp_secrets ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at   timestamptz NULL DEFAULT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE recovery_codes;
+DROP TABLE totp_secrets;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE login_attempts
+(
+    scope           VARCHAR(16)  NOT NULL,
+    subject         VARCHAR(255) NOT NULL,
+    failures        INT          NOT NULL DEFAULT 0,
+    last_failure_at timestamptz  NULL     DEFAULT NULL,
+    blocked_until   timestamptz  NULL     DEFAULT NULL,
+    PRIMARY KEY (scope, subject)
+);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN deleted_at timestamptz NULL DEFAULT NULL;
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE authorizations
+    DROP CONSTRAINT authorizations_user_id_fkey,
+    ADD CONSTRAINT authorizations_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users ON DELETE CASCADE;
+
+ALTER TABLE devices
+    DROP CONSTRAINT devices_authorization_id_fkey,
+    ADD CONSTRAINT devices_authorization_id_fkey
+        FOREIGN KEY (authorization_id) REFERENCES authorizations ON DELETE CASCADE;
+
+ALTER TABLE metrics
+    DROP CONSTRAINT metrics_trainee_id_fkey,
+    ADD CONSTRAINT metrics_trainee_id_fkey
+        FOREIGN KEY (trainee_id) REFERENCES trainees_profiles ON DELETE CASCADE;
+
+ALTER TABLE groups
+    ADD COLUMN archived_at timestamptz NULL DEFAULT NULL,
+    ALTER COLUMN coach_id DROP NOT NULL,
+    DROP CONSTRAINT groups_coach_id_fkey,
+    ADD CONSTRAINT groups_coach_id_fkey
+        FOREIGN KEY (coach_id) REFERENCES coaches_profiles ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM groups WHERE coach_id IS NULL;
+
+ALTER TABLE groups
+    DROP CONSTRAINT groups_coach_id_fkey,
+    ADD CONSTRAINT groups_coach_id_fkey
+        FOREIGN KEY (coach_id) REFERENCES coaches_profiles ON DELETE CASCADE,
+    ALTER COLUMN coach_id SET NOT NULL,
+    DROP COLUMN archived_at;
+
+ALTER TABLE metrics
+    DROP CONSTRAINT metrics_trainee_id_fkey,
+    ADD CONSTRAINT metrics_trainee_id_fkey
+        FOREIGN KEY (trainee_id) REFERENCES trainees_profiles;
+
+ALTER TABLE devices
+    DROP CONSTRAINT devices_authorization_id_fkey,
+    ADD CONSTRAINT devices_authorization_id_fkey
+        FOREIGN KEY (authorization_id) REFERENCES authorizations;
+
+ALTER TABLE authorizations
+    DROP CONSTRAINT authorizations_user_id_fkey,
+    ADD CONSTRAINT authorizations_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users;
+
+DROP INDEX users_deleted_at_idx;
+
+ALTER TABLE users
+    DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE data_exports
+(
+    export_id    uuid        NOT NULL PRIMARY KEY,
+    user_id      uuid        NOT NULL REFERENCES users ON DELETE CASCADE,
+    status       VARCHAR(16) NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    completed_at timestamptz NULL     DEFAULT NULL,
+    expires_at   timestamptz NULL     DEFAULT NULL,
+    archive      BYTEA       NULL     DEFAULT NULL
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+
+-- +goose Down
+DROP TABLE data_exports;
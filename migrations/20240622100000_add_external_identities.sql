@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE external_identities
+(
+    provider   VARCHAR(64)  NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    user_id    uuid         NOT NULL REFERENCES users ON DELETE CASCADE,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at timestamptz  NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE external_identities;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE api_keys
+(
+    key_id       uuid         NOT NULL PRIMARY KEY,
+    user_id      uuid         NOT NULL REFERENCES users ON DELETE CASCADE,
+    name         VARCHAR(64)  NOT NULL,
+    prefix       VARCHAR(16)  NOT NULL,
+    secret_hash  VARCHAR(64)  NOT NULL UNIQUE,
+    scopes       VARCHAR(255) NOT NULL,
+    created_at   timestamptz  NOT NULL DEFAULT now(),
+    last_used_at timestamptz  NULL     DEFAULT NULL,
+    revoked_at   timestamptz  NULL     DEFAULT NULL
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_keys;
+-- +goose StatementEnd
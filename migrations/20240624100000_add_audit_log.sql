@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE audit_log
+(
+    entry_id     BIGSERIAL    NOT NULL PRIMARY KEY,
+    user_id      uuid         NOT NULL REFERENCES users ON DELETE CASCADE,
+    actor_id     uuid         NULL,
+    action       VARCHAR(64)  NOT NULL,
+    ip_address   VARCHAR(255) NOT NULL DEFAULT '',
+    browser      VARCHAR(255) NOT NULL DEFAULT '',
+    os           VARCHAR(255) NOT NULL DEFAULT '',
+    device_model VARCHAR(255) NOT NULL DEFAULT '',
+    details      JSONB        NOT NULL DEFAULT '{}',
+    created_at   timestamptz  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_log_user_id_created_at_idx ON audit_log (user_id, created_at DESC);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER audit_log_append_only ON audit_log;
+DROP FUNCTION audit_log_append_only();
+DROP TABLE audit_log;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE magic_links
+(
+    link_id      uuid         NOT NULL PRIMARY KEY,
+    user_id      uuid         NOT NULL REFERENCES users ON DELETE CASCADE,
+    browser      VARCHAR(255) NOT NULL DEFAULT '',
+    os           VARCHAR(255) NOT NULL DEFAULT '',
+    device_model VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address   VARCHAR(255) NOT NULL DEFAULT '',
+    created_at   timestamptz  NOT NULL DEFAULT now(),
+    expires_at   timestamptz  NOT NULL,
+    used_at      timestamptz  NULL     DEFAULT NULL
+);
+
+CREATE INDEX magic_links_user_id_idx ON magic_links (user_id);
+
+-- +goose Down
+DROP TABLE magic_links;
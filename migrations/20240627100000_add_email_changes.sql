@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE email_changes
+(
+    change_id        uuid        NOT NULL PRIMARY KEY,
+    user_id          uuid        NOT NULL REFERENCES users ON DELETE CASCADE,
+    old_email        VARCHAR     NOT NULL,
+    new_email        VARCHAR     NOT NULL,
+    authorization_id uuid        NOT NULL,
+    created_at       timestamptz NOT NULL DEFAULT now(),
+    expires_at       timestamptz NOT NULL,
+    undo_until       timestamptz NOT NULL,
+    confirmed_at     timestamptz NULL     DEFAULT NULL,
+    reverted_at      timestamptz NULL     DEFAULT NULL
+);
+
+CREATE INDEX email_changes_user_id_idx ON email_changes (user_id);
+
+-- +goose Down
+DROP TABLE email_changes;
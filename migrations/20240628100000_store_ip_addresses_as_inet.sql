@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Addresses used to be copied from X-Forwarded-For as is, so a value may be
+-- a list of addresses or not an address at all. Keep the first address and
+-- drop what doesn't parse.
+CREATE FUNCTION pg_temp.to_inet(addr TEXT) RETURNS inet AS
+$$
+BEGIN
+    RETURN host(trim(split_part(addr, ',', 1))::inet)::inet;
+EXCEPTION
+    WHEN others THEN RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE devices
+    ALTER COLUMN ip_address DROP DEFAULT,
+    ALTER COLUMN ip_address DROP NOT NULL,
+    ALTER COLUMN ip_address TYPE inet USING pg_temp.to_inet(ip_address),
+    ADD COLUMN country VARCHAR(2)   NOT NULL DEFAULT '',
+    ADD COLUMN asn     BIGINT       NOT NULL DEFAULT 0,
+    ADD COLUMN as_org  VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE audit_log
+    ALTER COLUMN ip_address DROP DEFAULT,
+    ALTER COLUMN ip_address DROP NOT NULL,
+    ALTER COLUMN ip_address TYPE inet USING pg_temp.to_inet(ip_address);
+
+ALTER TABLE magic_links
+    ALTER COLUMN ip_address DROP DEFAULT,
+    ALTER COLUMN ip_address DROP NOT NULL,
+    ALTER COLUMN ip_address TYPE inet USING pg_temp.to_inet(ip_address);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE magic_links
+    ALTER COLUMN ip_address TYPE VARCHAR(255) USING coalesce(host(ip_address), ''),
+    ALTER COLUMN ip_address SET DEFAULT '',
+    ALTER COLUMN ip_address SET NOT NULL;
+
+ALTER TABLE audit_log
+    ALTER COLUMN ip_address TYPE VARCHAR(255) USING coalesce(host(ip_address), ''),
+    ALTER COLUMN ip_address SET DEFAULT '',
+    ALTER COLUMN ip_address SET NOT NULL;
+
+ALTER TABLE devices
+    DROP COLUMN as_org,
+    DROP COLUMN asn,
+    DROP COLUMN country,
+    ALTER COLUMN ip_address TYPE VARCHAR(15) USING
+        CASE WHEN family(ip_address) = 4 THEN host(ip_address) ELSE '' END,
+    ALTER COLUMN ip_address SET DEFAULT '',
+    ALTER COLUMN ip_address SET NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE mfa_challenges
+(
+    challenge_id uuid        NOT NULL PRIMARY KEY,
+    user_id      uuid        NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL,
+    failures     INT         NOT NULL DEFAULT 0,
+    used_at      timestamptz NULL     DEFAULT NULL
+);
+
+CREATE INDEX mfa_challenges_user_id_idx ON mfa_challenges (user_id);
+
+-- Encrypted secrets don't fit into the old column.
+ALTER TABLE totp_secrets
+    ALTER COLUMN secret TYPE VARCHAR(255);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE mfa_challenges;
+-- +goose StatementEnd
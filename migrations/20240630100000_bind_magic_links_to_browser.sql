@@ -0,0 +1,9 @@
+-- +goose Up
+-- Links requested before the column existed can't be used anymore; they
+-- expire within minutes anyway.
+ALTER TABLE magic_links
+    ADD COLUMN nonce_hash VARCHAR(255) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE magic_links
+    DROP COLUMN nonce_hash;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Entries outlive the accounts they describe: purging a user must neither
+-- remove nor rewrite them.
+ALTER TABLE audit_log
+    DROP CONSTRAINT audit_log_user_id_fkey;
+
+DROP TRIGGER audit_log_append_only ON audit_log;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER audit_log_append_only ON audit_log;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+
+ALTER TABLE audit_log
+    ADD CONSTRAINT audit_log_user_id_fkey FOREIGN KEY (user_id) REFERENCES users ON DELETE CASCADE NOT VALID;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The token is generated when the reset is mailed, so the event announcing
+-- the reset doesn't carry it.
+ALTER TABLE password_resets
+    ALTER COLUMN token_hash DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE
+FROM password_resets
+WHERE token_hash IS NULL;
+
+ALTER TABLE password_resets
+    ALTER COLUMN token_hash SET NOT NULL;
+-- +goose StatementEnd
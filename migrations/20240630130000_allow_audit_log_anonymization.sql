@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Purging an account erases the personal data of its entries: the device
+-- and the email addresses. Every other change is still rejected.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.entry_id = OLD.entry_id
+        AND NEW.user_id = OLD.user_id
+        AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id
+        AND NEW.action = OLD.action
+        AND NEW.created_at = OLD.created_at
+        AND NEW.ip_address IS NULL
+        AND NEW.browser = ''
+        AND NEW.os = ''
+        AND NEW.device_model = ''
+        AND NEW.details = OLD.details - 'old_email' - 'new_email'
+    THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Checking the address in the application doesn't stop concurrent sign-ups
+-- and email changes from taking the same one.
+CREATE UNIQUE INDEX users_lower_email_key ON users (lower(email));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_lower_email_key;
+-- +goose StatementEnd